@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/todylcom/sevenzip"
+)
+
+// Archive is a source of comic strips. It has to stay open for as long as
+// its entries are served.
+type Archive interface {
+	Entries() []Entry
+	Close() error
+}
+
+// Entry is a single file of an Archive. Names always use forward slashes.
+type Entry interface {
+	Name() string
+	FileInfo() fs.FileInfo
+	Open() (io.ReadCloser, error)
+}
+
+// sevenzipArchive is a 7z archive.
+type sevenzipArchive struct {
+	*sevenzip.ReadCloser
+}
+
+func (a sevenzipArchive) Entries() []Entry {
+	entries := make([]Entry, len(a.File))
+	for i, f := range a.File {
+		entries[i] = sevenzipEntry{f}
+	}
+	return entries
+}
+
+type sevenzipEntry struct {
+	*sevenzip.File
+}
+
+func (e sevenzipEntry) Name() string {
+	return e.File.Name
+}
+
+// zipArchive is a ZIP archive.
+type zipArchive struct {
+	*zip.ReadCloser
+}
+
+func (a zipArchive) Entries() []Entry {
+	entries := make([]Entry, len(a.File))
+	for i, f := range a.File {
+		entries[i] = zipEntry{f}
+	}
+	return entries
+}
+
+type zipEntry struct {
+	*zip.File
+}
+
+func (e zipEntry) Name() string {
+	return e.File.Name
+}
+
+// tarArchive is a gzip-compressed tarball. Tar streams can only be read
+// forward, so unlike the random-access 7z and ZIP readers every regular
+// member is read into memory while opening. This trades memory, roughly the
+// uncompressed archive size, for cheap random access when serving.
+type tarArchive struct {
+	entries []Entry
+}
+
+func openTarArchive(path string) (*tarArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	a := &tarArchive{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return a, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		a.entries = append(a.entries, tarEntry{hdr: hdr, data: data})
+	}
+}
+
+func (a *tarArchive) Entries() []Entry { return a.entries }
+func (a *tarArchive) Close() error     { return nil }
+
+type tarEntry struct {
+	hdr  *tar.Header
+	data []byte
+}
+
+func (e tarEntry) Name() string          { return strings.TrimPrefix(e.hdr.Name, "./") }
+func (e tarEntry) FileInfo() fs.FileInfo { return e.hdr.FileInfo() }
+
+func (e tarEntry) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+func isTarGz(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// dirArchive is a directory tree on disk, its entries are the files below
+// the root named by their relative path.
+type dirArchive struct {
+	entries []Entry
+}
+
+func openDirArchive(root string) (*dirArchive, error) {
+	a := &dirArchive{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		a.entries = append(a.entries, dirEntry{name: filepath.ToSlash(rel), path: path, info: info})
+		return nil
+	})
+	return a, err
+}
+
+func (a *dirArchive) Entries() []Entry { return a.entries }
+func (a *dirArchive) Close() error     { return nil }
+
+type dirEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+func (e dirEntry) Name() string                 { return e.name }
+func (e dirEntry) FileInfo() fs.FileInfo        { return e.info }
+func (e dirEntry) Open() (io.ReadCloser, error) { return os.Open(e.path) }
+
+// isZip tells ZIP and 7z archives apart by extension, or by their magic
+// bytes if the extension is neither.
+func isZip(path string) (bool, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip":
+		return true, nil
+	case ".7z":
+		return false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, err
+	}
+	return bytes.Equal(magic, []byte("PK\x03\x04")), nil
+}
+
+// openArchive opens the directory, tar.gz, ZIP or 7z archive at path.
+func openArchive(path string) (Archive, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return openDirArchive(path)
+	}
+
+	if isTarGz(path) {
+		return openTarArchive(path)
+	}
+
+	zipped, err := isZip(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if zipped {
+		arc, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		return zipArchive{arc}, nil
+	}
+
+	arc, err := sevenzip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return sevenzipArchive{arc}, nil
+}
+
+// entryCRC32 returns the CRC32 stored in the 7z and ZIP archive headers, and
+// false for other entries.
+func entryCRC32(e Entry) (uint32, bool) {
+	switch f := e.(type) {
+	case sevenzipEntry:
+		return f.CRC32, true
+	case zipEntry:
+		return f.CRC32, true
+	}
+	return 0, false
+}
+
+// entryETag derives a strong ETag from the CRC32 stored in 7z and ZIP
+// archive headers, and from size and modification time for other entries.
+func entryETag(e Entry) string {
+	info := e.FileInfo()
+	if crc, ok := entryCRC32(e); ok {
+		return fmt.Sprintf("%08x-%x", crc, info.Size())
+	}
+	return fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+}
+
+// multiArchive merges several archives. Its entries are those of the
+// archives in the order they were given.
+type multiArchive struct {
+	archives []Archive
+	entries  []Entry
+	sources  []int
+}
+
+func newMultiArchive(archives []Archive) *multiArchive {
+	m := &multiArchive{archives: archives}
+	for i, arc := range archives {
+		for _, e := range arc.Entries() {
+			m.entries = append(m.entries, e)
+			m.sources = append(m.sources, i)
+		}
+	}
+	return m
+}
+
+func (m *multiArchive) Entries() []Entry {
+	return m.entries
+}
+
+// source returns the index of the archive that entry i of Entries is from.
+func (m *multiArchive) source(i int) int {
+	return m.sources[i]
+}
+
+func (m *multiArchive) Close() error {
+	var errs []error
+	for _, arc := range m.archives {
+		errs = append(errs, arc.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// openArchives opens the archives at paths, merging them if there are
+// several.
+func openArchives(paths []string) (Archive, error) {
+	if len(paths) == 1 {
+		return openArchive(paths[0])
+	}
+
+	archives := make([]Archive, 0, len(paths))
+	for _, path := range paths {
+		arc, err := openArchive(path)
+		if err != nil {
+			for _, opened := range archives {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		archives = append(archives, arc)
+	}
+	return newMultiArchive(archives), nil
+}
+
+// archivePaths is a flag.Value collecting archive paths. It may be given
+// several times, each time with a comma-separated list.
+type archivePaths []string
+
+func (p *archivePaths) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *archivePaths) Set(value string) error {
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			*p = append(*p, path)
+		}
+	}
+	return nil
+}
+
+// findArchive looks for the single archive in dir.
+func findArchive(dir string) (string, error) {
+	var found []string
+	for _, pattern := range []string{"*.7z", "*.zip", "*.tar.gz", "*.tgz"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return "", err
+		}
+		found = append(found, matches...)
+	}
+
+	switch len(found) {
+	case 0:
+		return "", errors.New("no 7z, ZIP or tar.gz archive found in the working directory, pass one with -archive")
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("several archives found in the working directory (%s), pick one with -archive", strings.Join(found, ", "))
+	}
+}
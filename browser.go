@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"runtime"
+)
+
+// browserURL returns the URL to open the app at, served from addr.
+func browserURL(addr net.Addr, tls bool) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	// A server listening on all interfaces is reached locally.
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + basePath + "/"
+}
+
+// openBrowser opens url in the default browser of the desktop.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the opener once it's done, it usually hands the URL off and exits.
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// verifyArchives scans the archives at paths and reports the index to w. It
+// returns the exit status, which is non-zero if any file was skipped or no
+// strips were found.
+func verifyArchives(w io.Writer, paths []string) int {
+	arc, err := openArchives(paths)
+	if err != nil {
+		fmt.Fprintln(w, "Unable to open archive:", err)
+		return 1
+	}
+	defer arc.Close()
+
+	idx := scanComics(arc)
+
+	fmt.Fprintf(w, "Strips:  %d\n", len(idx.allStrips))
+	if len(idx.allStrips) > 0 {
+		fmt.Fprintf(w, "Range:   %s to %s\n",
+			idx.allStrips[0].Date.Format("2006-01-02"),
+			idx.allStrips[len(idx.allStrips)-1].Date.Format("2006-01-02"))
+	}
+	fmt.Fprintf(w, "Years:   %d\n", len(idx.yearsList))
+	fmt.Fprintf(w, "Skipped: %d\n", len(idx.skippedFiles))
+	for _, f := range idx.skippedFiles {
+		fmt.Fprintf(w, "  %s: %s\n", f.Path, f.Reason)
+	}
+
+	if len(idx.allStrips) == 0 || len(idx.skippedFiles) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// listEntry is a strip as printed by the list command.
+type listEntry struct {
+	Date StripDate `json:"date"`
+	Year string    `json:"year"`
+	Path string    `json:"path"`
+}
+
+// listStrips scans the archives at paths and prints every strip to w, as
+// tab-separated date, year and archive path, or as JSON lines if format is
+// "json".
+func listStrips(w io.Writer, paths []string, format string) error {
+	if format != "tsv" && format != "json" {
+		return fmt.Errorf("invalid list format %q", format)
+	}
+
+	arc, err := openArchives(paths)
+	if err != nil {
+		return err
+	}
+	defer arc.Close()
+
+	idx := scanComics(arc)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, year := range idx.yearsList {
+		for _, strip := range idx.stripsByYear[year] {
+			path := stripKey(strip)
+			if f, ok := idx.stripsByPath[path]; ok {
+				path = f.Name()
+			}
+
+			if format == "json" {
+				if err := enc.Encode(listEntry{Date: strip.Date, Year: strip.Year, Path: path}); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(bw, "%s\t%s\t%s\n", strip.Date.Format("2006-01-02"), strip.Year, path)
+		}
+	}
+	return bw.Flush()
+}
+
+// runList runs the list command with its command-line arguments.
+func runList(args []string, paths []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	format := fs.String("format", "tsv", "Output format, tsv or json")
+	fs.Parse(args)
+
+	if err := listStrips(os.Stdout, paths, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
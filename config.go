@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// loadConfig applies the TOML file at path to the flags of fs. Its keys are
+// flag names, like
+//
+//	archive = "/srv/dilbert.7z"
+//	port = 8080
+//	write-timeout = "10m"
+//	rate-limit = 2.5
+//
+// Arrays set the flag once per element, for flags that may be repeated like
+// archive = ["a.7z", "b.7z"]. Flags given on the command line or through the
+// environment take precedence over the file.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	var values map[string]any
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+
+		elems, ok := value.([]any)
+		if !ok {
+			elems = []any{value}
+		}
+		for _, elem := range elems {
+			s, ok := configValue(elem)
+			if !ok {
+				return fmt.Errorf("%s: option %q has unsupported type %T", path, name, elem)
+			}
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("%s: option %q: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue formats a TOML value the way it would be given on the command
+// line. It reports false for tables, nested arrays and dates.
+func configValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// envName returns the environment variable bound to the flag name, like
+// DILBERTD_WRITE_TIMEOUT for write-timeout.
+func envName(name string) string {
+	return "DILBERTD_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// documentEnv adds the environment variable of every flag of fs to its usage
+// text, so -help lists them.
+func documentEnv(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		f.Usage += " (env " + envName(f.Name) + ")"
+	})
+}
+
+// loadEnv sets the flags of fs that weren't given on the command line from
+// their environment variables.
+func loadEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// byteSize is a flag.Value for sizes like "512MB" or "2GiB". Plain numbers are
+// bytes.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	value = strings.TrimSpace(value)
+	factor := int64(1)
+	for _, unit := range byteUnits {
+		if len(value) > len(unit.suffix) && strings.EqualFold(value[len(value)-len(unit.suffix):], unit.suffix) {
+			factor = unit.factor
+			value = strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n * float64(factor))
+	return nil
+}
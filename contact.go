@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// contactColumns is the number of thumbnails per row of a contact sheet,
+// contactGap the space around each of them.
+const contactColumns = 8
+const contactGap = 4
+
+// maxContactPixels caps the size of a contact sheet, which is held in memory
+// uncompressed while it's drawn.
+const maxContactPixels = 32 << 20
+
+var errContactTooLarge = errors.New("contact sheet exceeds the maximum pixel count")
+
+var contactCache = imageCache{name: "contact"}
+
+// contactMu serializes building contact sheets, each of which decodes a whole
+// year of strips.
+var contactMu sync.Mutex
+
+// contactTag identifies the contact sheet of strips, changing whenever one of
+// their archive members does.
+func contactTag(idx *stripIndex, strips []ComicStrip) string {
+	h := fnv.New64a()
+	for _, strip := range strips {
+		key := stripKey(strip)
+		if f, ok := idx.stripsByPath[key]; ok {
+			h.Write([]byte(key + "#" + entryETag(f) + "\n"))
+		}
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// contactSheet tiles the thumbnails of strips into a single JPEG. Strips that
+// can't be decoded are left out.
+func contactSheet(idx *stripIndex, year, tag string, strips []ComicStrip) ([]byte, error) {
+	key := year + "#" + tag
+	if data, ok := contactCache.get(key); ok {
+		return data, nil
+	}
+
+	contactMu.Lock()
+	defer contactMu.Unlock()
+	if data, ok := contactCache.get(key); ok {
+		return data, nil
+	}
+
+	var thumbs []image.Image
+	for _, strip := range strips {
+		path := stripKey(strip)
+		f, ok := idx.stripsByPath[path]
+		if !ok {
+			continue
+		}
+
+		data, err := thumbnail(path, f)
+		if err != nil {
+			slog.Warn("Unable to add strip to contact sheet", "path", path, "error", err)
+			continue
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			slog.Warn("Unable to add strip to contact sheet", "path", path, "error", err)
+			continue
+		}
+		thumbs = append(thumbs, img)
+	}
+	if len(thumbs) == 0 {
+		return nil, errors.New("no strip could be decoded")
+	}
+
+	// Every row is as high as its highest thumbnail.
+	columns := min(contactColumns, len(thumbs))
+	var rowHeights []int
+	for i := 0; i < len(thumbs); i += columns {
+		h := 0
+		for _, img := range thumbs[i:min(i+columns, len(thumbs))] {
+			h = max(h, img.Bounds().Dy())
+		}
+		rowHeights = append(rowHeights, h)
+	}
+
+	width := columns*thumbWidth + (columns+1)*contactGap
+	height := (len(rowHeights) + 1) * contactGap
+	for _, h := range rowHeights {
+		height += h
+	}
+	if width*height > maxContactPixels {
+		return nil, errContactTooLarge
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	y := contactGap
+	for row, h := range rowHeights {
+		x := contactGap
+		for _, img := range thumbs[row*columns : min((row+1)*columns, len(thumbs))] {
+			b := img.Bounds()
+			draw.Draw(sheet, image.Rect(x, y, x+b.Dx(), y+b.Dy()), img, b.Min, draw.Src)
+			x += thumbWidth + contactGap
+		}
+		y += h + contactGap
+	}
+
+	data, err := encodeJPEG(sheet)
+	if err != nil {
+		return nil, err
+	}
+	contactCache.put(key, data)
+	return data, nil
+}
+
+// serveContact answers /contact/{year}.jpg with the contact sheet of a year.
+// It changes when the archive is reloaded, so it's revalidated by its ETag.
+func serveContact(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	year, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/contact/"), ".jpg")
+	strips, found := idx.stripsByYear[year]
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	tag := contactTag(idx, strips)
+	etag := `"` + tag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := contactSheet(idx, year, tag, strips)
+	if err != nil {
+		slog.Error("Unable to create contact sheet", "year", year, "error", err)
+		http.Error(w, "Unable to create contact sheet", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCache keeps derived images in a directory, so they survive a restart.
+// Once the files exceed maxBytes, the least recently used are removed.
+type diskCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *diskCacheItem, most recently used first
+	items    map[string]*list.Element
+}
+
+type diskCacheItem struct {
+	name string
+	size int64
+}
+
+// derivedCache is the on-disk cache shared by all image caches, nil unless
+// -cache-dir is set.
+var derivedCache *diskCache
+
+// openDiskCache uses dir as a disk cache, picking up the files left there by
+// an earlier run. Their modification time serves as the last use.
+func openDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		item    *diskCacheItem
+		modTime time.Time
+	}
+	var files []file
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{&diskCacheItem{e.Name(), info.Size()}, info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b file) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	c := &diskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	for _, f := range files {
+		c.items[f.item.name] = c.lru.PushBack(f.item)
+		c.size += f.item.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func diskCacheName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *diskCache) get(key string) ([]byte, bool) {
+	name := diskCacheName(key)
+
+	c.mu.Lock()
+	el, ok := c.items[name]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		slog.Warn("Unable to read cached image", "key", key, "error", err)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(c.dir, name), now, now)
+	return data, true
+}
+
+func (c *diskCache) put(key string, data []byte) {
+	name := diskCacheName(key)
+	path := filepath.Join(c.dir, name)
+
+	// Write to a temporary file first so readers never see a partial image.
+	// Every writer gets its own, concurrent misses for a key are common.
+	f, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		slog.Warn("Unable to write cached image", "key", key, "error", err)
+		return
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		slog.Warn("Unable to write cached image", "key", key, "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[name]; ok {
+		item := el.Value.(*diskCacheItem)
+		c.size -= item.size
+		item.size = int64(len(data))
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[name] = c.lru.PushFront(&diskCacheItem{name, int64(len(data))})
+	}
+	c.size += int64(len(data))
+	c.evict()
+}
+
+// evict removes the least recently used files until the cache fits into
+// maxBytes. c.mu must be held.
+func (c *diskCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		el := c.lru.Back()
+		item := el.Value.(*diskCacheItem)
+		if err := os.Remove(filepath.Join(c.dir, item.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Unable to evict cached image", "file", item.name, "error", err)
+		}
+		c.lru.Remove(el)
+		delete(c.items, item.name)
+		c.size -= item.size
+	}
+}
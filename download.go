@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// stripKey returns the stripsByPath key of an indexed strip.
+func stripKey(strip ComicStrip) string {
+	key, _ := url.PathUnescape(strings.TrimPrefix(strip.URL, basePath+"/comics/"))
+	return key
+}
+
+// serveDownload streams the strips of a year, requested as
+// /download/{year}.zip, or of the whole archive, requested as
+// /download/all.zip, as a ZIP archive. Every strip has to be decompressed
+// from the source archive, so a full download keeps a CPU core busy for as
+// long as it runs.
+func serveDownload(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	name := strings.TrimPrefix(r.URL.Path, "/download/")
+	year, ok := strings.CutSuffix(name, ".zip")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if year == "all" {
+		writeZip(w, r, "dilbert-complete.zip", idx.allStrips)
+		return
+	}
+
+	strips, ok := idx.stripsByYear[year]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeZip(w, r, "dilbert-"+year+".zip", strips)
+}
+
+// writeZip streams strips into a ZIP archive as they are read from the
+// source archive, so only one strip is held in memory at a time. The images
+// are already compressed and are stored as is. HEAD requests only get the
+// headers, the archive isn't built for them.
+func writeZip(w http.ResponseWriter, r *http.Request, filename string, strips []ComicStrip) {
+	idx := requestIndex(r)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Large downloads outlast the server's write timeout.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("Unable to clear write deadline for download", "error", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, strip := range strips {
+		key := stripKey(strip)
+		f, ok := idx.stripsByPath[key]
+		if !ok {
+			continue
+		}
+		if err := addToZip(r, zw, key, f); err != nil {
+			slog.Warn("Aborting download", "file", filename, "path", f.Name(), "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Warn("Unable to finish download", "file", filename, "error", err)
+	}
+}
+
+func addToZip(r *http.Request, zw *zip.Writer, name string, f Entry) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: f.FileInfo().ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, contextReader{r.Context(), rc})
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"io/fs"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeArchive is an in-memory Archive whose entries fail to open once it is
+// closed, like the members of a closed 7z or ZIP file.
+type fakeArchive struct {
+	entries []Entry
+	closed  atomic.Bool
+}
+
+// newFakeArchive returns an archive with a small GIF for every name, in the
+// given order.
+func newFakeArchive(t *testing.T, names ...string) *fakeArchive {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 60, 20), gifPalette), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	arc := &fakeArchive{}
+	for _, name := range names {
+		arc.entries = append(arc.entries, fakeEntry{arc, name, buf.Bytes()})
+	}
+	return arc
+}
+
+var gifPalette = []color.Color{color.White, color.Black}
+
+func (a *fakeArchive) Entries() []Entry { return a.entries }
+
+func (a *fakeArchive) Close() error {
+	a.closed.Store(true)
+	return nil
+}
+
+type fakeEntry struct {
+	arc  *fakeArchive
+	name string
+	data []byte
+}
+
+func (e fakeEntry) Name() string { return e.name }
+
+func (e fakeEntry) FileInfo() fs.FileInfo { return fakeInfo{path.Base(e.name), int64(len(e.data))} }
+
+func (e fakeEntry) Open() (io.ReadCloser, error) {
+	if e.arc.closed.Load() {
+		return nil, errors.New("archive is closed")
+	}
+	return io.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+type fakeInfo struct {
+	name string
+	size int64
+}
+
+func (i fakeInfo) Name() string       { return i.name }
+func (i fakeInfo) Size() int64        { return i.size }
+func (i fakeInfo) Mode() fs.FileMode  { return 0o644 }
+func (i fakeInfo) ModTime() time.Time { return time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC) }
+func (i fakeInfo) IsDir() bool        { return false }
+func (i fakeInfo) Sys() any           { return nil }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// defaultFeedItems and maxFeedItems bound the "n" query parameter of the feeds.
+const defaultFeedItems = 20
+const maxFeedItems = 100
+
+// recentStrips returns the "n" most recent strips of the archive, newest
+// first. It writes an error response and returns false if n is malformed.
+func recentStrips(w http.ResponseWriter, r *http.Request) ([]ComicStrip, bool) {
+	idx := requestIndex(r)
+	n := defaultFeedItems
+	if v := r.URL.Query().Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Malformed item count", http.StatusBadRequest)
+			return nil, false
+		}
+		n = min(parsed, maxFeedItems)
+	}
+
+	recent := slices.Clone(idx.allStrips[max(0, len(idx.allStrips)-n):])
+	slices.Reverse(recent)
+	return recent, true
+}
+
+// baseURL returns the scheme and host the request was made to, as forwarded
+// by a trusted proxy if there is one. Strip URLs already carry the base path,
+// other links need it appended.
+func baseURL(r *http.Request) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host
+}
+
+func stripTitle(strip ComicStrip) string {
+	return "Dilbert " + strip.Date.Format("2006-01-02")
+}
+
+func writeXML(w http.ResponseWriter, contentType, what string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("Error encoding feed", "feed", what, "error", err)
+		return
+	}
+	w.Write([]byte("\n"))
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string  `xml:"title"`
+	Link    string  `xml:"link"`
+	GUID    rssGUID `xml:"guid"`
+	PubDate string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// serveRSS lists the most recent strips as an RSS 2.0 feed.
+func serveRSS(w http.ResponseWriter, r *http.Request) {
+	strips, ok := recentStrips(w, r)
+	if !ok {
+		return
+	}
+
+	base := baseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Dilbert",
+			Link:        base + basePath + "/",
+			Description: "The most recent Dilbert strips in the archive",
+		},
+	}
+	if len(strips) > 0 {
+		feed.Channel.LastBuildDate = strips[0].Date.Format(time.RFC1123Z)
+	}
+	for _, strip := range strips {
+		link := base + strip.URL
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:   stripTitle(strip),
+			Link:    link,
+			GUID:    rssGUID{IsPermaLink: true, Value: link},
+			PubDate: strip.Date.Format(time.RFC1123Z),
+		})
+	}
+
+	writeXML(w, "application/rss+xml", "RSS", feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+}
+
+// serveAtom lists the most recent strips as an Atom 1.0 feed.
+func serveAtom(w http.ResponseWriter, r *http.Request) {
+	strips, ok := recentStrips(w, r)
+	if !ok {
+		return
+	}
+
+	base := baseURL(r)
+	feed := atomFeed{
+		ID:      base + basePath + "/feed.atom",
+		Title:   "Dilbert",
+		Updated: time.Time{}.Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Scott Adams"},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + basePath + "/feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: base + basePath + "/"},
+		},
+	}
+	if len(strips) > 0 {
+		feed.Updated = strips[0].Date.Format(time.RFC3339)
+	}
+	for _, strip := range strips {
+		link := base + strip.URL
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      link,
+			Title:   stripTitle(strip),
+			Updated: strip.Date.Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Href: link},
+				{Rel: "enclosure", Type: mime.TypeByExtension(path.Ext(strip.URL)), Href: link},
+			},
+		})
+	}
+
+	writeXML(w, "application/atom+xml", "Atom", feed)
+}
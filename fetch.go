@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// isArchiveURL reports whether the -archive value is to be downloaded.
+func isArchiveURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// archiveExt returns the file extension of the archive at rawURL, which has
+// to be kept for the downloaded file so its format is detected.
+func archiveExt(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := strings.ToLower(path.Base(u.Path))
+	if strings.HasSuffix(name, ".tar.gz") {
+		return ".tar.gz"
+	}
+	return path.Ext(name)
+}
+
+// progressWriter counts the bytes written through it.
+type progressWriter struct {
+	n atomic.Int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.n.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// fetchArchive downloads the archive at rawURL to a temporary file and returns
+// its path. The download must be complete, and match checksum, a hex SHA-256
+// digest, unless that is empty. The caller removes the file.
+func fetchArchive(ctx context.Context, rawURL, checksum string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	f, err := os.CreateTemp("", "dilbertd-*"+archiveExt(rawURL))
+	if err != nil {
+		return "", err
+	}
+	fail := func(err error) (string, error) {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	slog.Info("Downloading archive", "url", rawURL, "bytes", resp.ContentLength)
+
+	progress := &progressWriter{}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				slog.Info("Downloading archive", "url", rawURL, "received", progress.n.Load(), "bytes", resp.ContentLength)
+			}
+		}
+	}()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash, progress), resp.Body)
+	close(done)
+	if err != nil {
+		return fail(err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fail(fmt.Errorf("incomplete download, got %d of %d bytes", n, resp.ContentLength))
+	}
+
+	if checksum != "" {
+		if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, checksum) {
+			return fail(fmt.Errorf("checksum mismatch, got sha256 %s", sum))
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	slog.Info("Downloaded archive", "url", rawURL, "path", f.Name(), "bytes", n)
+	return f.Name(), nil
+}
@@ -0,0 +1,102 @@
+// Service worker keeping the app shell and recently viewed comics available
+// offline. URLs are relative to the worker, so it works below a base path.
+const SHELL_CACHE = "dilbertd-shell-v1";
+const COMICS_CACHE = "dilbertd-comics-v1";
+const MAX_COMICS = 200;
+
+const SHELL = [
+  "./",
+  "main.css",
+  "favicon.ico",
+  "manifest.webmanifest",
+  "icon-192.png",
+  "icon-512.png",
+];
+
+self.addEventListener("install", (event) => {
+  event.waitUntil(
+    caches.open(SHELL_CACHE).then((cache) => cache.addAll(SHELL)),
+  );
+  self.skipWaiting();
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches
+      .keys()
+      .then((keys) =>
+        Promise.all(
+          keys
+            .filter((key) => key !== SHELL_CACHE && key !== COMICS_CACHE)
+            .map((key) => caches.delete(key)),
+        ),
+      )
+      .then(() => self.clients.claim()),
+  );
+});
+
+// trimComics drops the oldest comics once more than MAX_COMICS are cached.
+async function trimComics(cache) {
+  const keys = await cache.keys();
+  for (const key of keys.slice(0, Math.max(0, keys.length - MAX_COMICS))) {
+    await cache.delete(key);
+  }
+}
+
+// Comics never change while the archive is loaded, so they are served from
+// the cache first.
+async function comic(request) {
+  const cache = await caches.open(COMICS_CACHE);
+  const cached = await cache.match(request);
+  if (cached) {
+    return cached;
+  }
+
+  const response = await fetch(request);
+  if (response.ok) {
+    await cache.put(request, response.clone());
+    await trimComics(cache);
+  }
+  return response;
+}
+
+// The shell is fetched from the network first, so updates show up, and only
+// served from the cache when offline. Other pages, like deep links to a
+// strip, fall back to the cached app.
+async function shell(request, cacheable) {
+  try {
+    const response = await fetch(request);
+    if (response.ok && cacheable) {
+      const cache = await caches.open(SHELL_CACHE);
+      await cache.put(request, response.clone());
+    }
+    return response;
+  } catch (err) {
+    const cached = await caches.match(request, { ignoreSearch: true });
+    if (cached) {
+      return cached;
+    }
+    if (request.mode === "navigate") {
+      return caches.match("./");
+    }
+    throw err;
+  }
+}
+
+self.addEventListener("fetch", (event) => {
+  const request = event.request;
+  const url = new URL(request.url);
+  if (request.method !== "GET" || url.origin !== self.location.origin) {
+    return;
+  }
+
+  const path = url.pathname.slice(
+    new URL(self.registration.scope).pathname.length,
+  );
+  const cacheable = path === "" || SHELL.includes(path);
+  if (path.startsWith("comics/") || path.startsWith("thumbs/")) {
+    event.respondWith(comic(request));
+  } else if (request.mode === "navigate" || cacheable) {
+    event.respondWith(shell(request, cacheable));
+  }
+});
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// thumbWidth is the maximum width of the images served by serveThumbs.
+const thumbWidth = 200
+
+// maxResizeDimension caps the width and height accepted by serveComics for
+// resizing, so huge requests can't exhaust memory.
+const maxResizeDimension = 2000
+
+// imageCache holds encoded derived images, keyed by the archive path, the
+// entry's ETag and the parameters they were generated with. Images are also
+// kept in derivedCache if there is one, under the cache's name.
+//
+// If maxBytes is set, the least recently used images are dropped from memory
+// beyond it.
+type imageCache struct {
+	name     string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List // of *lruItem, most recently used first
+	items map[string]*list.Element
+}
+
+func (c *imageCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	var data []byte
+	el, ok := c.items[key]
+	if ok {
+		c.lru.MoveToFront(el)
+		data = el.Value.(*lruItem).data
+	}
+	c.mu.Unlock()
+	if ok || derivedCache == nil {
+		return data, ok
+	}
+
+	data, ok = derivedCache.get(c.name + ":" + key)
+	if ok {
+		c.remember(key, data)
+	}
+	return data, ok
+}
+
+func (c *imageCache) put(key string, data []byte) {
+	c.remember(key, data)
+	if derivedCache != nil {
+		derivedCache.put(c.name+":"+key, data)
+	}
+}
+
+func (c *imageCache) remember(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxBytes > 0 && int64(len(data)) > c.maxBytes {
+		return
+	}
+	if c.items == nil {
+		c.lru = list.New()
+		c.items = make(map[string]*list.Element)
+	}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+
+	for c.maxBytes > 0 && c.size+int64(len(data)) > c.maxBytes {
+		el := c.lru.Back()
+		item := el.Value.(*lruItem)
+		c.lru.Remove(el)
+		delete(c.items, item.key)
+		c.size -= int64(len(item.data))
+	}
+	c.items[key] = c.lru.PushFront(&lruItem{key, data})
+	c.size += int64(len(data))
+}
+
+func (c *imageCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru, c.items, c.size = nil, nil, 0
+}
+
+var thumbCache = imageCache{name: "thumb"}
+
+// resizeCache and webpCache get their memory budget from -image-cache-size.
+var resizeCache = imageCache{name: "resize"}
+var webpCache = imageCache{name: "webp"}
+
+// maxDecodePixels is the largest image, in pixels, that is decoded. It guards
+// against decompression bombs in untrusted archives, 0 disables it.
+var maxDecodePixels int64
+
+var errImageTooLarge = errors.New("image exceeds the maximum pixel count")
+
+// checkPixels fails for images larger than maxDecodePixels.
+func checkPixels(cfg image.Config) error {
+	if maxDecodePixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return fmt.Errorf("%w: %dx%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// decodeImage decodes f once its header has passed checkPixels.
+func decodeImage(f Entry) (image.Image, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Archive members can't be rewound, so the header read for the check is
+	// kept and fed to the decoder again.
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(rc, &header))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPixels(cfg); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, rc))
+	return img, err
+}
+
+// fitSize returns the size of a srcWidth x srcHeight image fit into width x
+// height while preserving its aspect ratio. A zero dimension is derived from
+// the other one. Images are never scaled up.
+func fitSize(srcWidth, srcHeight, width, height int) (int, int) {
+	if srcWidth == 0 || srcHeight == 0 {
+		return srcWidth, srcHeight
+	}
+
+	if width == 0 || width > srcWidth {
+		width = srcWidth
+	}
+	if height == 0 || height > srcHeight {
+		height = srcHeight
+	}
+
+	// Shrink whichever dimension is too large for the requested box.
+	if width*srcHeight < height*srcWidth {
+		height = max(1, width*srcHeight/srcWidth)
+	} else {
+		width = max(1, height*srcWidth/srcHeight)
+	}
+	return width, height
+}
+
+// outputSize returns the size a width x height request scales the strip at
+// key to. The source size is taken from the index, or from the image header
+// if it isn't known there.
+func outputSize(idx *stripIndex, key string, f Entry, width, height int) (int, int, error) {
+	var srcWidth, srcHeight int
+	if name := path.Base(key); len(name) >= 10 {
+		if strip, ok := idx.stripsByDate[name[:10]]; ok && stripKey(strip) == key {
+			srcWidth, srcHeight = strip.Width, strip.Height
+		}
+	}
+
+	if srcWidth == 0 || srcHeight == 0 {
+		rc, err := f.Open()
+		if err != nil {
+			return 0, 0, err
+		}
+		defer rc.Close()
+
+		cfg, _, err := image.DecodeConfig(rc)
+		if err != nil {
+			return 0, 0, err
+		}
+		srcWidth, srcHeight = cfg.Width, cfg.Height
+	}
+
+	width, height = fitSize(srcWidth, srcHeight, width, height)
+	return width, height, nil
+}
+
+// scaleImage resizes src to fit into width x height like fitSize.
+func scaleImage(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	width, height = fitSize(b.Dx(), b.Dy(), width, height)
+	if width == b.Dx() && height == b.Dy() {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeWebP(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func thumbnail(path string, f Entry) ([]byte, error) {
+	key := path + "#" + entryETag(f)
+	if data, ok := thumbCache.get(key); ok {
+		return data, nil
+	}
+
+	img, err := decodeImage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeJPEG(scaleImage(img, thumbWidth, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbCache.put(key, data)
+	return data, nil
+}
+
+// parseResize reads the "w" and "h" query parameters. Both are zero if no
+// resize was requested.
+func parseResize(r *http.Request) (int, int, bool) {
+	query := r.URL.Query()
+	parse := func(name string) (int, bool) {
+		v := query.Get(name)
+		if v == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, false
+		}
+		return min(n, maxResizeDimension), true
+	}
+
+	width, ok := parse("w")
+	if !ok {
+		return 0, 0, false
+	}
+	height, ok := parse("h")
+	if !ok {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// resized scales f to width x height, which should be the output size from
+// outputSize so requests beyond the source size share a cache entry.
+func resized(path string, f Entry, width, height int) ([]byte, error) {
+	key := path + "#" + entryETag(f) + "?w=" + strconv.Itoa(width) + "&h=" + strconv.Itoa(height)
+	if data, ok := resizeCache.get(key); ok {
+		return data, nil
+	}
+
+	img, err := decodeImage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeJPEG(scaleImage(img, width, height))
+	if err != nil {
+		return nil, err
+	}
+
+	resizeCache.put(key, data)
+	return data, nil
+}
+
+// webp re-encodes f as lossless WebP, optionally resized to width x height.
+func webp(path string, f Entry, width, height int) ([]byte, error) {
+	key := path + "#" + entryETag(f) + "?w=" + strconv.Itoa(width) + "&h=" + strconv.Itoa(height)
+	if data, ok := webpCache.get(key); ok {
+		return data, nil
+	}
+
+	img, err := decodeImage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if width != 0 || height != 0 {
+		img = scaleImage(img, width, height)
+	}
+
+	data, err := encodeWebP(img)
+	if err != nil {
+		return nil, err
+	}
+
+	webpCache.put(key, data)
+	return data, nil
+}
+
+// The placeholder keeps the proportions of a daily strip unless the request
+// asks for a size.
+const placeholderWidth = 600
+const placeholderHeight = 200
+
+// servePlaceholder answers with a generated "no strip" image for galleries
+// that would break on missing images.
+func servePlaceholder(w http.ResponseWriter, width, height int) {
+	if width == 0 && height == 0 {
+		width, height = placeholderWidth, placeholderHeight
+	} else if width == 0 {
+		width = height * placeholderWidth / placeholderHeight
+	} else if height == 0 {
+		height = width * placeholderHeight / placeholderWidth
+	}
+
+	// A strip may show up with the next reload, so the placeholder isn't
+	// cached like the comics are.
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+
+		`<rect width="100%%" height="100%%" fill="#eee"/>`+
+		`<text x="50%%" y="50%%" fill="#999" font-family="sans-serif" font-size="%d" text-anchor="middle" dominant-baseline="middle">No strip</text>`+
+		"</svg>\n", width, height, width, height, max(8, min(width, height)/6))
+}
+
+func serveThumbs(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	reqStrip := requestedStrip(r, "/thumbs/")
+	file, found := idx.stripsByPath[reqStrip]
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := thumbnail(reqStrip, file)
+	if err != nil {
+		slog.Error("Unable to create thumbnail", "path", reqStrip, "error", err)
+		http.Error(w, "Unable to create thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	// Comics get their length from http.ServeContent, thumbnails are
+	// written directly and would otherwise be chunked once they outgrow the
+	// response buffer.
+	setComicCacheControl(w)
+	if len(signingKey) > 0 {
+		setSignedCacheControl(w, r)
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stripIndex is everything known about the loaded archive. It isn't modified
+// once built; a reload swaps in a new one.
+type stripIndex struct {
+	arc Archive
+
+	stripsByYear map[string][]ComicStrip
+
+	// stripsByPath maps the unescaped path below /comics/ to its archive
+	// member. Indexed strips are keyed by "year/file", matching their URL,
+	// other servable files by their normalized member name.
+	stripsByPath     map[string]Entry
+	yearsList        []string
+	yearDetails      []YearDetail
+	allStrips        []ComicStrip
+	stripsByDate     map[string]ComicStrip
+	stripsByMonthDay map[string][]ComicStrip
+	weekdayCounts    map[string]int
+	skippedFiles     []SkippedFile
+	skipSummary      []SkipSummary
+	firstStrip       *ComicStrip
+	lastStrip        *ComicStrip
+
+	// preload holds the decompressed strips of arc, nil unless -preload is
+	// set.
+	preload *preloadCache
+
+	// version increases with every index loaded by the server.
+	version uint64
+
+	// checksums caches the CRC32 of members whose archive doesn't store it,
+	// by stripsByPath key.
+	checksumMu sync.Mutex
+	checksums  map[string]uint32
+
+	// refs counts the requests using the index. Once the index is retired
+	// and no longer used, its archive is closed.
+	refs      atomic.Int64
+	retired   atomic.Bool
+	closeOnce sync.Once
+}
+
+// currentIndex is the index requests are served from.
+var currentIndex atomic.Pointer[stripIndex]
+
+// indexVersions hands out the index versions. Together with indexEpoch,
+// which tells apart versions of different server processes, they identify
+// the API responses of an index.
+var indexVersions atomic.Uint64
+var indexEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// acquireIndex returns the current index, which stays usable until it is
+// released. It is nil until the archive has been loaded.
+func acquireIndex() *stripIndex {
+	for {
+		idx := currentIndex.Load()
+		if idx == nil {
+			return nil
+		}
+		idx.refs.Add(1)
+		// A reload may have retired idx before the reference was taken.
+		if currentIndex.Load() == idx {
+			return idx
+		}
+		idx.release()
+	}
+}
+
+func (idx *stripIndex) release() {
+	if idx.refs.Add(-1) == 0 && idx.retired.Load() {
+		idx.close()
+	}
+}
+
+// retire marks a replaced index, closing its archive as soon as the last
+// request using it is done.
+func (idx *stripIndex) retire() {
+	idx.retired.Store(true)
+	if idx.refs.Load() == 0 {
+		idx.close()
+	}
+}
+
+func (idx *stripIndex) close() {
+	idx.closeOnce.Do(func() {
+		if err := idx.arc.Close(); err != nil {
+			slog.Warn("Unable to close archive", "error", err)
+		}
+	})
+}
+
+type indexKey struct{}
+
+// loadingRetryAfter is the Retry-After value, in seconds, sent while the
+// archive is being loaded.
+const loadingRetryAfter = "5"
+
+// indexHandler makes the current index available to next through
+// requestIndex, for the whole duration of the request. Before the archive has
+// been loaded, only the exempt paths are passed to next, which have to cope
+// with a nil index; other requests are answered with a 503.
+func indexHandler(exempt []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idx := acquireIndex()
+		if idx == nil {
+			if slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", loadingRetryAfter)
+			w.Header().Set("Cache-Control", "no-store")
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeJSONError(w, "Archive is still loading", http.StatusServiceUnavailable)
+			} else {
+				http.Error(w, "Archive is still loading", http.StatusServiceUnavailable)
+			}
+			return
+		}
+		defer idx.release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), indexKey{}, idx)))
+	})
+}
+
+// requestIndex returns the index a request is served from, nil only for the
+// paths exempted by indexHandler.
+func requestIndex(r *http.Request) *stripIndex {
+	if idx, ok := r.Context().Value(indexKey{}).(*stripIndex); ok {
+		return idx
+	}
+	return currentIndex.Load()
+}
+
+// indexETagHandler tags the responses of next, which must only depend on the
+// index and the request URL, so clients can revalidate them until a reload.
+// The tag is weak as the response may be compressed.
+func indexETagHandler(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := fnv.New64a()
+		h.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+		etag := fmt.Sprintf(`"%s-%d-%x"`, indexEpoch, requestIndex(r).version, h.Sum64())
+
+		w.Header().Set("ETag", "W/"+etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(w, r)
+	})
+}
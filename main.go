@@ -1,24 +1,58 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"path"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/todylcom/sevenzip"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	_ "golang.org/x/image/webp"
 )
 
+// Build information, set at build time via -ldflags "-X main.version=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+}
+
+var buildInfo = BuildInfo{Version: version, Commit: commit, BuildDate: buildDate}
+
 type StripDate struct {
 	time.Time
 }
@@ -28,90 +62,449 @@ func (j StripDate) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + formatted + `"`), nil
 }
 
+func (j *StripDate) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("strip date must be a string: %w", err)
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return fmt.Errorf("malformed strip date %q: %w", s, err)
+	}
+	j.Time = t
+	return nil
+}
+
 type ComicStrip struct {
-	Date StripDate `json:"date"`
-	Year string    `json:"year"`
-	URL  string    `json:"url"`
+	Date   StripDate `json:"date"`
+	Year   string    `json:"year"`
+	URL    string    `json:"url"`
+	Width  int       `json:"width,omitempty"`
+	Height int       `json:"height,omitempty"`
 }
 
-var stripsByYear map[string][]ComicStrip
-var stripsByPath map[string]*sevenzip.File
-var yearsList []string
+// ready is set once the archive has been scanned and contains strips.
+var ready atomic.Bool
 
-func scanComics(arc *sevenzip.ReadCloser) {
-	stripsByPath = make(map[string]*sevenzip.File)
-	stripsByYear = make(map[string][]ComicStrip)
-	yearSet := make(map[string]bool)
+// scanWorkers is the number of goroutines parsing archive members.
+var scanWorkers int
 
-	for _, f := range arc.File {
-		info := f.FileInfo()
-		path := f.Name
+// quietSkips logs skipped archive members at debug level only, leaving the
+// per-folder summary.
+var quietSkips bool
 
-		if !info.Mode().IsRegular() {
-			continue
-		}
+// extensions lists the lower-case file extensions, including the dot, that
+// scanComics indexes, in order of preference for files sharing a date.
+var extensions = []string{".jpg", ".gif"}
+
+// basePath is the path prefix, without a trailing slash, that all routes and
+// strip URLs are served below. It is empty when serving from the root.
+var basePath string
+
+// normalizeBasePath turns "dilbert/" or "/dilbert" into "/dilbert".
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".jpg" && ext != ".gif" {
-			log.Printf("Skipping unmatched file in archive %s", path)
+// parseExtensions turns a comma-separated list like "jpg,GIF,.png" into the
+// normalized form used by extensions.
+func parseExtensions(list string) ([]string, error) {
+	var exts []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
 			continue
 		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if !slices.Contains(exts, ext) {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return nil, errors.New("no file extensions given")
+	}
+	return exts, nil
+}
+
+// comicMaxAge is how long clients may cache comic images.
+var comicMaxAge time.Duration
+
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// SkipSummary counts the files skipped in a folder for the same reason.
+type SkipSummary struct {
+	Folder string `json:"folder"`
+	Reason string `json:"reason"`
+	Files  int    `json:"files"`
+}
+
+// Reasons for skipping an archive member in scanComics.
+const (
+	skipExtension     = "unmatched file extension"
+	skipYearFolder    = "year folder format mismatch"
+	skipDateFormat    = "date format mismatch"
+	skipMalformedDate = "malformed date format"
+	skipYearMismatch  = "year folder does not match date"
+	skipDuplicate     = "date already provided by an earlier archive"
+	skipDuplicateDate = "date already provided by a preferred file"
+	skipTooLarge      = "image exceeds -max-decode-pixels"
+)
+
+// skip records a skipped archive member. Skips are also summarized per folder
+// once the scan is done.
+func (idx *stripIndex) skip(path, reason string) {
+	level := slog.LevelWarn
+	if quietSkips {
+		level = slog.LevelDebug
+	}
+	slog.Log(context.Background(), level, "Skipping file in archive", "path", path, "reason", reason)
+	idx.skippedFiles = append(idx.skippedFiles, SkippedFile{Path: path, Reason: reason})
+}
+
+// imageSize reads the dimensions from the image header of f. Strips whose
+// header can't be decoded are still served, just without known dimensions.
+// It reports false for images exceeding maxDecodePixels.
+func imageSize(f Entry) (int, int, bool) {
+	rc, err := f.Open()
+	if err != nil {
+		slog.Warn("Unable to open file for reading image size", "path", f.Name(), "error", err)
+		return 0, 0, true
+	}
+	defer rc.Close()
+
+	cfg, _, err := image.DecodeConfig(rc)
+	if err != nil {
+		slog.Warn("Unable to decode image size", "path", f.Name(), "error", err)
+		return 0, 0, true
+	}
+	if checkPixels(cfg) != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// scanResult is the outcome of parsing a single archive member. Files with a
+// matching extension are servable even if they are skipped from the index.
+type scanResult struct {
+	servable bool
+	key      string
+	reason   string
+	strip    ComicStrip
+}
+
+func scanFile(f Entry) scanResult {
+	info := f.FileInfo()
+
+	if !info.Mode().IsRegular() {
+		return scanResult{}
+	}
+
+	// Archives created on Windows may use backslashes, and the year folders
+	// may sit below any number of top-level folders.
+	name := strings.ReplaceAll(f.Name(), "\\", "/")
+
+	ext := strings.ToLower(path.Ext(name))
+	if !slices.Contains(extensions, ext) {
+		return scanResult{reason: skipExtension}
+	}
+
+	dir, file := path.Split(name)
+	year := path.Base(dir)
+	if len(year) != 4 {
+		return scanResult{servable: true, key: name, reason: skipYearFolder}
+	}
+
+	if len(file) < 10 || file[4] != '-' || file[7] != '-' {
+		return scanResult{servable: true, key: name, reason: skipDateFormat}
+	}
+
+	dateStr := file[:10]
+	t, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return scanResult{servable: true, key: name, reason: skipMalformedDate}
+	}
+
+	if fmt.Sprintf("%d", t.Year()) != year {
+		return scanResult{servable: true, key: name, reason: skipYearMismatch}
+	}
+
+	width, height, ok := imageSize(f)
+	if !ok {
+		return scanResult{servable: true, key: year + "/" + file, reason: skipTooLarge}
+	}
+	return scanResult{
+		servable: true,
+		key:      year + "/" + file,
+		strip: ComicStrip{
+			Date:   StripDate{t},
+			Year:   year,
+			URL:    basePath + "/comics/" + year + "/" + url.PathEscape(file),
+			Width:  width,
+			Height: height,
+		},
+	}
+}
+
+// scanComics indexes the entries of arc using scanWorkers goroutines. The
+// results are merged in archive order afterwards, so logging and the skipped
+// list don't depend on scheduling.
+func scanComics(arc Archive) *stripIndex {
+	entries := arc.Entries()
+	idx := &stripIndex{
+		arc:          arc,
+		stripsByPath: make(map[string]Entry),
+		stripsByYear: make(map[string][]ComicStrip),
+	}
+
+	results := make([]scanResult, len(entries))
+	jobs := make(chan int)
 
-		stripsByPath[path] = f
+	var wg sync.WaitGroup
+	for range max(1, scanWorkers) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = scanFile(entries[i])
+			}
+		})
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-		dir, file := filepath.Split(path)
-		dir = filepath.Clean(dir)
-		year := filepath.Base(dir)
-		if len(year) != 4 {
-			log.Printf("Skipping file in archive %s, year folder format mismatch", path)
+	// When merging archives, a date provided by an earlier archive wins over
+	// the same date in later ones. Within an archive, the file with the
+	// extension listed first in extensions wins, then the lowest path.
+	source := func(int) int { return 0 }
+	if m, ok := arc.(*multiArchive); ok {
+		source = m.source
+	}
+	preferred := func(i, j int) bool {
+		if si, sj := source(i), source(j); si != sj {
+			return si < sj
+		}
+		ei := slices.Index(extensions, strings.ToLower(path.Ext(results[i].key)))
+		ej := slices.Index(extensions, strings.ToLower(path.Ext(results[j].key)))
+		if ei != ej {
+			return ei < ej
+		}
+		return results[i].key < results[j].key
+	}
+	winners := make(map[string]int)
+	for i, res := range results {
+		if res.reason != "" || res.strip.Year == "" {
 			continue
 		}
+		date := res.strip.Date.Format("2006-01-02")
+		if w, seen := winners[date]; !seen || preferred(i, w) {
+			winners[date] = i
+		}
+	}
 
-		if len(file) < 10 || file[4] != '-' || file[7] != '-' {
-			log.Printf("Skipping file in archive %s, date format mismatch", path)
-			continue
+	for i, res := range results {
+		path := entries[i].Name()
+		if res.servable {
+			if _, dup := idx.stripsByPath[res.key]; !dup {
+				idx.stripsByPath[res.key] = entries[i]
+			}
 		}
 
-		dateStr := file[:10]
-		t, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
-			log.Printf("Skipping file in archive %s, malformed date format", path)
-			continue
+		if res.reason == "" && res.strip.Year != "" {
+			if w := winners[res.strip.Date.Format("2006-01-02")]; w != i {
+				res.reason = skipDuplicateDate
+				if source(w) != source(i) {
+					res.reason = skipDuplicate
+				}
+			}
 		}
 
-		if fmt.Sprintf("%d", t.Year()) != year {
-			log.Printf("Skipping file in archive %s, year folder does not match date", path)
+		if res.reason != "" {
+			idx.skip(path, res.reason)
 			continue
 		}
 
-		stripsByYear[year] = append(stripsByYear[year], ComicStrip{
-			Date: StripDate{t},
-			Year: year,
-			URL:  "/comics/" + year + "/" + url.PathEscape(strings.Split(path, "/")[1]),
+		if res.strip.Year != "" {
+			idx.stripsByYear[res.strip.Year] = append(idx.stripsByYear[res.strip.Year], res.strip)
+		}
+	}
+
+	idx.build()
+	for _, sum := range idx.skipSummary {
+		slog.Warn("Skipped files in folder", "folder", sum.Folder, "files", sum.Files, "reason", sum.Reason)
+	}
+	slog.Info("Scanned archive", "files", len(entries), "strips", len(idx.allStrips), "skipped", len(idx.skippedFiles))
+	return idx
+}
+
+// build derives the sorted year list and all lookup indexes from
+// idx.stripsByYear.
+func (idx *stripIndex) build() {
+	idx.yearsList = make([]string, 0, len(idx.stripsByYear))
+
+	for y := range idx.stripsByYear {
+		idx.yearsList = append(idx.yearsList, y)
+	}
+	sort.Strings(idx.yearsList)
+
+	// Sort every year explicitly through the map, so the sorted slice is what
+	// ends up in the index.
+	for _, y := range idx.yearsList {
+		strips := idx.stripsByYear[y]
+		slices.SortStableFunc(strips, func(a, b ComicStrip) int {
+			return a.Date.Compare(b.Date.Time)
+		})
+		idx.stripsByYear[y] = strips
+	}
+
+	idx.allStrips = nil
+	idx.yearDetails = make([]YearDetail, 0, len(idx.yearsList))
+	for _, y := range idx.yearsList {
+		strips := idx.stripsByYear[y]
+		idx.allStrips = append(idx.allStrips, strips...)
+		idx.yearDetails = append(idx.yearDetails, YearDetail{
+			Year:  y,
+			First: strips[0].Date,
+			Last:  strips[len(strips)-1].Date,
+			Count: len(strips),
 		})
-		yearSet[year] = true
 	}
 
-	yearsList = make([]string, 0, len(yearSet))
+	idx.firstStrip, idx.lastStrip = nil, nil
+	if len(idx.allStrips) > 0 {
+		idx.firstStrip = &idx.allStrips[0]
+		idx.lastStrip = &idx.allStrips[len(idx.allStrips)-1]
+	}
+
+	idx.stripsByDate = make(map[string]ComicStrip, len(idx.allStrips))
+	idx.stripsByMonthDay = make(map[string][]ComicStrip)
+	idx.weekdayCounts = make(map[string]int, 7)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		idx.weekdayCounts[d.String()] = 0
+	}
+	for _, strip := range idx.allStrips {
+		idx.weekdayCounts[strip.Date.Weekday().String()]++
+
+		date := strip.Date.Format("2006-01-02")
+		if _, ok := idx.stripsByDate[date]; !ok {
+			idx.stripsByDate[date] = strip
+		}
 
-	for y := range yearSet {
-		yearsList = append(yearsList, y)
+		monthDay := strip.Date.Format("01-02")
+		idx.stripsByMonthDay[monthDay] = append(idx.stripsByMonthDay[monthDay], strip)
 	}
-	sort.Strings(yearsList)
 
-	for _, strips := range stripsByYear {
-		sort.Slice(strips, func(i, j int) bool {
-			return strips[i].Date.Before(strips[j].Date.Time)
+	idx.skipSummary = nil
+	for _, f := range idx.skippedFiles {
+		folder := path.Dir(strings.ReplaceAll(f.Path, "\\", "/"))
+		i := slices.IndexFunc(idx.skipSummary, func(s SkipSummary) bool {
+			return s.Folder == folder && s.Reason == f.Reason
 		})
+		if i < 0 {
+			idx.skipSummary = append(idx.skipSummary, SkipSummary{Folder: folder, Reason: f.Reason})
+			i = len(idx.skipSummary) - 1
+		}
+		idx.skipSummary[i].Files++
+	}
+	slices.SortFunc(idx.skipSummary, func(a, b SkipSummary) int {
+		return cmp.Or(strings.Compare(a.Folder, b.Folder), strings.Compare(a.Reason, b.Reason))
+	})
+}
+
+// mediaQuality returns the quality the Accept header value gives to the media
+// type typ, like "application/json", which is 0 if it isn't accepted.
+func mediaQuality(accept, typ string) float64 {
+	major, _, _ := strings.Cut(typ, "/")
+	best, specificity := 0.0, -1
+	for _, field := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(field, ";")
+		mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+
+		s := -1
+		switch mediaRange {
+		case typ:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		best, specificity = q, s
+	}
+	return best
+}
+
+// APIIndex is returned for the root to clients preferring JSON over HTML.
+type APIIndex struct {
+	Name    string            `json:"name"`
+	Version string            `json:"version"`
+	Links   map[string]string `json:"links"`
+}
+
+func serveAPIIndex(w http.ResponseWriter) {
+	links := map[string]string{
+		"years":    "/api/years",
+		"strips":   "/api/strips/{year}",
+		"strip":    "/api/strip/{date}",
+		"search":   "/api/search?q={date prefix}",
+		"calendar": "/api/calendar?year={year}&month={month}",
+		"random":   "/api/random",
+		"daily":    "/api/daily",
+		"first":    "/api/first",
+		"last":     "/api/last",
+		"stats":    "/api/stats",
+		"all":      "/api/all",
+		"rss":      "/feed.rss",
+		"atom":     "/feed.atom",
+		"health":   "/healthz",
+		"version":  "/version",
 	}
+	for name, link := range links {
+		links[name] = basePath + link
+	}
+	writeJSON(w, "API index", APIIndex{Name: "dilbertd", Version: version, Links: links})
 }
 
 func serveApp(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 
 	if path == "/" {
+		// Browsers get the app, API clients asking for JSON a list of
+		// endpoints.
+		w.Header().Set("Vary", "Accept")
+		if accept := r.Header.Get("Accept"); mediaQuality(accept, "application/json") > mediaQuality(accept, "text/html") {
+			serveAPIIndex(w)
+			return
+		}
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write(indexHTML)
+		w.Write(renderIndex(pageMeta{title: "Dilbert", url: baseURL(r) + basePath + "/"}))
 		return
 	}
 
@@ -120,93 +513,1570 @@ func serveApp(w http.ResponseWriter, r *http.Request) {
 		w.Write(mainCSS)
 		return
 	}
+
+	if f, ok := staticFiles[path]; ok {
+		w.Header().Set("Content-Type", f.contentType)
+		w.Header().Set("Cache-Control", f.cacheControl)
+		w.Write(f.data)
+		return
+	}
 	http.NotFound(w, r)
 }
 
-func serveYearsAPI(w http.ResponseWriter, r *http.Request) {
+// staticFile is an embedded file served as is by serveApp.
+type staticFile struct {
+	contentType  string
+	cacheControl string
+	data         []byte
+}
+
+// staticFiles are the icons and the files making the app installable. The
+// service worker is revalidated, so updates to it are picked up right away.
+var staticFiles = map[string]staticFile{
+	"/favicon.ico":          {"image/x-icon", "public, max-age=604800", favicon},
+	"/icon-192.png":         {"image/png", "public, max-age=604800", icon192},
+	"/icon-512.png":         {"image/png", "public, max-age=604800", icon512},
+	"/manifest.webmanifest": {"application/manifest+json", "public, max-age=86400", webManifest},
+	"/sw.js":                {"text/javascript; charset=utf-8", "no-cache", serviceWorker},
+}
+
+// writeJSON encodes v as the response. API data may change when the archive
+// is reloaded, so unless a handler set its own caching policy clients are
+// asked to revalidate.
+func writeJSON(w http.ResponseWriter, what string, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(yearsList); err != nil {
-		log.Printf("Error encoding years API data: %v", err)
-		http.Error(w, "Error encoding data", http.StatusInternalServerError)
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding API data", "data", what, "error", err)
+		writeJSONError(w, "Error encoding data", http.StatusInternalServerError)
 	}
 }
 
-func serveStripsAPI(w http.ResponseWriter, r *http.Request) {
-	year := strings.TrimPrefix(r.URL.Path, "/api/strips/")
+// APIError is the body of API error responses.
+type APIError struct {
+	Error string `json:"error"`
+}
 
-	if strips, ok := stripsByYear[year]; ok {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(strips); err != nil {
-			log.Printf("Error encoding strips API data for %s: %v", year, err)
-			http.Error(w, "Error encoding data", http.StatusInternalServerError)
-		}
+// writeJSONError is http.Error for the API, answering with msg as JSON.
+func writeJSONError(w http.ResponseWriter, msg string, code int) {
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(APIError{Error: msg})
+}
+
+// serveAPINotFound answers requests for unknown API routes.
+func serveAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, "Not found", http.StatusNotFound)
+}
+
+func serveYearsAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	years, ok := orderList(w, r, idx.yearsList)
+	if !ok {
 		return
 	}
-	http.NotFound(w, r)
+	writeJSON(w, "years API data", years)
 }
 
-func serveComics(w http.ResponseWriter, r *http.Request) {
-	reqStrip := strings.TrimPrefix(r.URL.Path, "/comics/")
-	file, found := stripsByPath[reqStrip]
-	if found {
-		f, err := file.Open()
-		if err != nil {
-			log.Printf("Unable to open comic strip %s: %v", reqStrip, err)
-			http.Error(w, "Unable to open comic strip", http.StatusInternalServerError)
-			return
+// YearDetail describes a year in the years detail API.
+type YearDetail struct {
+	Year  string    `json:"year"`
+	First StripDate `json:"first"`
+	Last  StripDate `json:"last"`
+	Count int       `json:"count"`
+}
+
+func serveYearsDetailAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	years, ok := orderList(w, r, idx.yearDetails)
+	if !ok {
+		return
+	}
+	writeJSON(w, "years detail API data", years)
+}
+
+// maxRangeYears caps the span of a from/to query on the strips API.
+const maxRangeYears = 5
+
+// serveStripsRange returns all strips between the inclusive "from" and "to"
+// query parameters, across year boundaries.
+func serveStripsRange(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	query := r.URL.Query()
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		writeJSONError(w, "Malformed from date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		writeJSONError(w, "Malformed to date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	if to.Before(from) {
+		writeJSONError(w, "The to date must not be before the from date", http.StatusBadRequest)
+		return
+	}
+
+	if to.After(from.AddDate(maxRangeYears, 0, 0)) {
+		writeJSONError(w, fmt.Sprintf("Date range must not exceed %d years", maxRangeYears), http.StatusBadRequest)
+		return
+	}
+
+	i := sort.Search(len(idx.allStrips), func(i int) bool {
+		return !idx.allStrips[i].Date.Before(from)
+	})
+	j := sort.Search(len(idx.allStrips), func(j int) bool {
+		return idx.allStrips[j].Date.After(to)
+	})
+	strips, ok := filterWeekday(w, r, idx.allStrips[i:j])
+	if !ok {
+		return
+	}
+
+	strips, ok = orderList(w, r, strips)
+	if !ok {
+		return
+	}
+	writeJSON(w, "strips API data for range", strips)
+}
+
+// parseWeekday accepts a weekday either by its English name, full or
+// abbreviated to three letters, or by its number with Sunday being 0.
+func parseWeekday(s string) (time.Weekday, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 6 {
+			return 0, false
 		}
-		defer f.Close()
+		return time.Weekday(n), true
+	}
 
-		_, err = io.Copy(w, f)
-		if err != nil {
-			log.Printf("Unable to serve comic strip %s: %v", reqStrip, err)
-			http.Error(w, "Unable to serve comic strip", http.StatusInternalServerError)
-			return
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return d, true
 		}
-	} else {
-		http.NotFound(w, r)
 	}
+	return 0, false
 }
 
-func main() {
-	var dilbertArc string
-	var port uint
+// filterWeekday applies the "weekday" query parameter to strips, keeping only
+// the strips published on that day of the week.
+func filterWeekday(w http.ResponseWriter, r *http.Request, strips []ComicStrip) ([]ComicStrip, bool) {
+	v := r.URL.Query().Get("weekday")
+	if v == "" {
+		return strips, true
+	}
 
-	flag.StringVar(&dilbertArc, "archive", "Dilbert_1989-2023_complete.7z", "Path to dilbert archive")
-	flag.UintVar(&port, "port", 8080, "Port to listen on")
-	flag.Parse()
+	weekday, ok := parseWeekday(v)
+	if !ok {
+		writeJSONError(w, "Malformed weekday", http.StatusBadRequest)
+		return nil, false
+	}
 
-	arc, err := sevenzip.OpenReader(dilbertArc)
-	if err != nil {
-		log.Printf("Unable to open archive: %v", err)
-		os.Exit(1)
+	filtered := []ComicStrip{}
+	for _, strip := range strips {
+		if strip.Date.Weekday() == weekday {
+			filtered = append(filtered, strip)
+		}
+	}
+	return filtered, true
+}
+
+// orderList applies the "order" query parameter to the ascending list, like
+// strips or years. Descending order returns a reversed copy so the shared
+// index is never mutated.
+func orderList[T any](w http.ResponseWriter, r *http.Request, list []T) ([]T, bool) {
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+		return list, true
+	case "desc":
+		reversed := slices.Clone(list)
+		slices.Reverse(reversed)
+		return reversed, true
 	}
-	defer arc.Close()
+	writeJSONError(w, "Malformed order, expected asc or desc", http.StatusBadRequest)
+	return nil, false
+}
 
-	scanComics(arc)
+// yearStrips returns the strips of a year, or of an inclusive range of years
+// like "2000-2005". Unknown years are answered with a 404, malformed ranges
+// with a 400, and reported by returning false.
+func yearStrips(w http.ResponseWriter, idx *stripIndex, spec string) ([]ComicStrip, bool) {
+	start, end, isRange := strings.Cut(spec, "-")
+	if !isRange {
+		strips, ok := idx.stripsByYear[spec]
+		if !ok {
+			writeJSONError(w, "Not found", http.StatusNotFound)
+		}
+		return strips, ok
+	}
 
-	if len(yearsList) == 0 {
-		log.Println("No comic strips were found in archive")
-		os.Exit(1)
+	for _, y := range []string{start, end} {
+		if _, err := strconv.Atoi(y); err != nil || len(y) != 4 {
+			writeJSONError(w, "Malformed year range, expected YYYY-YYYY", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if end < start {
+		writeJSONError(w, "The end of the year range must not be before its start", http.StatusBadRequest)
+		return nil, false
 	}
+	if _, ok := idx.stripsByYear[start]; !ok {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+	if _, ok := idx.stripsByYear[end]; !ok {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	// All strips are ordered by year, so the range is a contiguous part.
+	i := sort.Search(len(idx.allStrips), func(i int) bool { return idx.allStrips[i].Year >= start })
+	j := sort.Search(len(idx.allStrips), func(j int) bool { return idx.allStrips[j].Year > end })
+	return idx.allStrips[i:j], true
+}
 
-	http.HandleFunc("/api/years", serveYearsAPI)
+// YearCount is returned by the strips count API.
+type YearCount struct {
+	Year  string `json:"year"`
+	Count int    `json:"count"`
+}
 
-	http.HandleFunc("/api/strips/", serveStripsAPI)
+func serveStripsAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	year, sub, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/strips"), "/"), "/")
+	if year == "" {
+		serveStripsRange(w, r)
+		return
+	}
 
-	http.HandleFunc("/comics/", serveComics)
+	strips, ok := yearStrips(w, idx, year)
+	if !ok {
+		return
+	}
 
-	http.HandleFunc("/", serveApp)
+	switch sub {
+	case "":
+	case "count":
+		writeJSON(w, "strips count API data for "+year, YearCount{Year: year, Count: len(strips)})
+		return
+	default:
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
 
-	log.Printf("Serving %d comic strips at port %d", len(stripsByPath), port)
-	if err := http.ListenAndServe(":"+strconv.FormatUint(uint64(port), 10), nil); err != nil {
-		log.Printf("Failed to start webserver: %v", err)
-		os.Exit(1)
+	strips, ok = filterWeekday(w, r, strips)
+	if !ok {
+		return
+	}
+
+	strips, ok = orderList(w, r, strips)
+	if !ok {
+		return
+	}
+
+	// A year range may span more strips than a single year, it's returned
+	// whole unless the client asks for a smaller page.
+	strips, ok = paginate(w, r, strips, max(maxPageLimit, len(strips)))
+	if !ok {
+		return
 	}
+	writeJSON(w, "strips API data for "+year, strips)
 }
 
-//go:embed frontend/src/index.html
-var indexHTML []byte
+// The default page size covers a whole year so unpaginated clients still
+// receive every strip of the year in a single response.
+const maxPageLimit = 366
 
-//go:embed frontend/src/main.css
-var mainCSS []byte
+// paginate applies the "offset" and "limit" query parameters to strips,
+// clamping out-of-range values, and reports the unpaginated length in the
+// X-Total-Count header. The limit defaults to and is capped at maxLimit.
+// Malformed parameters are answered with a 400 and reported by returning
+// false.
+func paginate(w http.ResponseWriter, r *http.Request, strips []ComicStrip, maxLimit int) ([]ComicStrip, bool) {
+	query := r.URL.Query()
+
+	offset := 0
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSONError(w, "Malformed offset", http.StatusBadRequest)
+			return nil, false
+		}
+		offset = n
+	}
+
+	limit := maxLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSONError(w, "Malformed limit", http.StatusBadRequest)
+			return nil, false
+		}
+		limit = min(n, maxLimit)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(strips)))
+
+	offset = min(offset, len(strips))
+	end := min(offset+limit, len(strips))
+	return strips[offset:end], true
+}
+
+// validDatePrefix reports whether q is the beginning of a YYYY-MM-DD date.
+func validDatePrefix(q string) bool {
+	if q == "" || len(q) > len("2006-01-02") {
+		return false
+	}
+	for i, c := range q {
+		if i == 4 || i == 7 {
+			if c != '-' {
+				return false
+			}
+		} else if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// serveSearchAPI returns the strips whose YYYY-MM-DD date starts with the "q"
+// query parameter, like "2001" for a year or "2001-05" for a month, paginated
+// like the strips API.
+func serveSearchAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	q := r.URL.Query().Get("q")
+	if !validDatePrefix(q) {
+		writeJSONError(w, "Malformed query, expected the beginning of a YYYY-MM-DD date", http.StatusBadRequest)
+		return
+	}
+
+	// Formatted dates sort like the strips, so the matches are contiguous.
+	prefix := func(i int) string {
+		return idx.allStrips[i].Date.Format("2006-01-02")[:len(q)]
+	}
+	i := sort.Search(len(idx.allStrips), func(i int) bool { return prefix(i) >= q })
+	j := sort.Search(len(idx.allStrips), func(j int) bool { return prefix(j) > q })
+
+	strips, ok := paginate(w, r, idx.allStrips[i:j], maxPageLimit)
+	if !ok {
+		return
+	}
+	writeJSON(w, "search API data for "+q, strips)
+}
+
+// maxBatchDates caps the number of dates in a single batch lookup.
+const maxBatchDates = 100
+
+// serveBatchAPI looks up the strips for every "date" query parameter. The
+// response maps each requested date to its strip, or to null if there is no
+// strip for that day.
+func serveBatchAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	dates := r.URL.Query()["date"]
+	if len(dates) == 0 {
+		writeJSONError(w, "No dates requested", http.StatusBadRequest)
+		return
+	}
+
+	if len(dates) > maxBatchDates {
+		writeJSONError(w, fmt.Sprintf("Too many dates requested, at most %d are allowed", maxBatchDates), http.StatusBadRequest)
+		return
+	}
+
+	result := make(map[string]*ComicStrip, len(dates))
+	for _, date := range dates {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			writeJSONError(w, "Malformed date "+date+", expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		result[date] = nil
+		if strip, ok := idx.stripsByDate[date]; ok {
+			result[date] = &strip
+		}
+	}
+	writeJSON(w, "batch API data", result)
+}
+
+type StripNeighbors struct {
+	Prev *ComicStrip `json:"prev"`
+	Next *ComicStrip `json:"next"`
+}
+
+// findNeighbors returns the strips directly before and after date in the
+// chronological order of the whole archive, or nil at either boundary.
+func findNeighbors(idx *stripIndex, date time.Time) StripNeighbors {
+	var neighbors StripNeighbors
+
+	i := sort.Search(len(idx.allStrips), func(i int) bool {
+		return !idx.allStrips[i].Date.Before(date)
+	})
+	if i > 0 {
+		neighbors.Prev = &idx.allStrips[i-1]
+	}
+
+	j := sort.Search(len(idx.allStrips), func(j int) bool {
+		return idx.allStrips[j].Date.After(date)
+	})
+	if j < len(idx.allStrips) {
+		neighbors.Next = &idx.allStrips[j]
+	}
+	return neighbors
+}
+
+// linkNextStrip asks the client to preload the image of the strip following
+// date, if the request opted in with "preload=next".
+func linkNextStrip(w http.ResponseWriter, r *http.Request, idx *stripIndex, date time.Time) {
+	if r.URL.Query().Get("preload") != "next" {
+		return
+	}
+	if next := findNeighbors(idx, date).Next; next != nil {
+		w.Header().Add("Link", "<"+next.URL+">; rel=preload; as=image")
+	}
+}
+
+// StripMeta is returned by the strip meta API.
+type StripMeta struct {
+	Date StripDate `json:"date"`
+	URL  string    `json:"url"`
+	Size int64     `json:"size"`
+	// CRC32 is the IEEE checksum of the strip in hex, taken from the archive
+	// if it stores one, otherwise computed.
+	CRC32          string `json:"crc32"`
+	ChecksumSource string `json:"checksumSource"`
+}
+
+// stripChecksum returns the CRC32 of the member at key, and whether it comes
+// from the archive rather than being computed. Computed checksums are cached
+// in the index.
+func stripChecksum(ctx context.Context, idx *stripIndex, key string, f Entry) (uint32, bool, error) {
+	// 7z archives may omit the checksum, which leaves it 0.
+	if crc, ok := entryCRC32(f); ok && crc != 0 {
+		return crc, true, nil
+	}
+
+	idx.checksumMu.Lock()
+	crc, ok := idx.checksums[key]
+	idx.checksumMu.Unlock()
+	if ok {
+		return crc, false, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, contextReader{ctx, rc}); err != nil {
+		return 0, false, err
+	}
+
+	idx.checksumMu.Lock()
+	if idx.checksums == nil {
+		idx.checksums = make(map[string]uint32)
+	}
+	idx.checksums[key] = h.Sum32()
+	idx.checksumMu.Unlock()
+	return h.Sum32(), false, nil
+}
+
+func serveStripMeta(w http.ResponseWriter, r *http.Request, idx *stripIndex, strip ComicStrip) {
+	key := stripKey(strip)
+	f, ok := idx.stripsByPath[key]
+	if !ok {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	crc, stored, err := stripChecksum(r.Context(), idx, key, f)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		slog.Error("Unable to compute checksum", "path", key, "error", err)
+		writeJSONError(w, "Unable to compute checksum", http.StatusInternalServerError)
+		return
+	}
+
+	meta := StripMeta{
+		Date:           strip.Date,
+		URL:            strip.URL,
+		Size:           f.FileInfo().Size(),
+		CRC32:          fmt.Sprintf("%08x", crc),
+		ChecksumSource: "computed",
+	}
+	if stored {
+		meta.ChecksumSource = "archive"
+	}
+	writeJSON(w, "strip meta API data for "+strip.Date.Format("2006-01-02"), meta)
+}
+
+func serveStripAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	date, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/strip/"), "/")
+
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		writeJSONError(w, "Malformed date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	strip, ok := idx.stripsByDate[date]
+	if !ok {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch sub {
+	case "":
+		linkNextStrip(w, r, idx, t)
+		writeJSON(w, "strip API data for "+date, strip)
+	case "neighbors":
+		writeJSON(w, "neighbors API data for "+date, findNeighbors(idx, t))
+	case "meta":
+		serveStripMeta(w, r, idx, strip)
+	default:
+		writeJSONError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// defaultAround and maxAround are the default and largest number of strips
+// returned on either side of the date by the around API.
+const defaultAround = 3
+const maxAround = 50
+
+// serveAroundAPI returns the strips on the date given in the path, preceded by
+// up to "before" and followed by up to "after" strips in the chronological
+// order of the whole archive. The date itself doesn't need to have a strip.
+func serveAroundAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	date := strings.TrimPrefix(r.URL.Path, "/api/around/")
+
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		writeJSONError(w, "Malformed date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	count := func(name string) (int, bool) {
+		v := query.Get(name)
+		if v == "" {
+			return defaultAround, true
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSONError(w, "Malformed "+name+" count", http.StatusBadRequest)
+			return 0, false
+		}
+		return min(n, maxAround), true
+	}
+	before, ok := count("before")
+	if !ok {
+		return
+	}
+	after, ok := count("after")
+	if !ok {
+		return
+	}
+
+	i := sort.Search(len(idx.allStrips), func(i int) bool {
+		return !idx.allStrips[i].Date.Before(t)
+	})
+	j := sort.Search(len(idx.allStrips), func(j int) bool {
+		return idx.allStrips[j].Date.After(t)
+	})
+	writeJSON(w, "around API data for "+date, idx.allStrips[max(0, i-before):min(len(idx.allStrips), j+after)])
+}
+
+// serveOnThisDayAPI returns the strips published on today's month and day in
+// every year, or on the day given as MM-DD by the "date" query parameter.
+func serveOnThisDayAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	monthDay := r.URL.Query().Get("date")
+	if monthDay == "" {
+		monthDay = time.Now().Format("01-02")
+	} else if _, err := time.Parse("01-02", monthDay); err != nil {
+		writeJSONError(w, "Malformed date, expected MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	strips := idx.stripsByMonthDay[monthDay]
+	if strips == nil {
+		strips = []ComicStrip{}
+	}
+	writeJSON(w, "on this day API data for "+monthDay, strips)
+}
+
+type ArchiveStats struct {
+	Total    int            `json:"total"`
+	Years    map[string]int `json:"years"`
+	Earliest *StripDate     `json:"earliest"`
+	Latest   *StripDate     `json:"latest"`
+	Skipped  int            `json:"skipped"`
+	// Duplicates lists the files dropped for sharing a date with another
+	// strip.
+	Duplicates []SkippedFile `json:"duplicates"`
+	Preload    *PreloadStats `json:"preload,omitempty"`
+}
+
+func serveStatsAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	stats := ArchiveStats{
+		Total:      len(idx.allStrips),
+		Years:      make(map[string]int, len(idx.yearsList)),
+		Skipped:    len(idx.skippedFiles),
+		Duplicates: []SkippedFile{},
+	}
+	for _, f := range idx.skippedFiles {
+		if f.Reason == skipDuplicate || f.Reason == skipDuplicateDate {
+			stats.Duplicates = append(stats.Duplicates, f)
+		}
+	}
+
+	for _, year := range idx.yearsList {
+		stats.Years[year] = len(idx.stripsByYear[year])
+	}
+
+	if len(idx.allStrips) > 0 {
+		stats.Earliest = &idx.allStrips[0].Date
+		stats.Latest = &idx.allStrips[len(idx.allStrips)-1].Date
+	}
+
+	if idx.preload != nil {
+		stats.Preload = idx.preload.stats()
+	}
+	writeJSON(w, "stats API data", stats)
+}
+
+// serveWeekdayStatsAPI returns the number of strips per day of the week.
+func serveWeekdayStatsAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	writeJSON(w, "weekday stats API data", idx.weekdayCounts)
+}
+
+// serveSkippedAPI lists the skipped archive members, or how many were skipped
+// per folder and reason with "summary=1".
+func serveSkippedAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	if r.URL.Query().Get("summary") == "1" {
+		summary := idx.skipSummary
+		if summary == nil {
+			summary = []SkipSummary{}
+		}
+		writeJSON(w, "skipped summary API data", summary)
+		return
+	}
+
+	skipped := idx.skippedFiles
+	if skipped == nil {
+		skipped = []SkippedFile{}
+	}
+	writeJSON(w, "skipped API data", skipped)
+}
+
+// serveMissingAPI lists the calendar days between the first and last strip of
+// the archive, or of the year given by the "year" query parameter, for which
+// no strip exists.
+func serveMissingAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	strips := idx.allStrips
+	if year := r.URL.Query().Get("year"); year != "" {
+		var ok bool
+		if strips, ok = idx.stripsByYear[year]; !ok {
+			writeJSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	missing := []StripDate{}
+	if len(strips) > 0 {
+		last := strips[len(strips)-1].Date.Time
+		for t := strips[0].Date.Time; !t.After(last); t = t.AddDate(0, 0, 1) {
+			if _, ok := idx.stripsByDate[t.Format("2006-01-02")]; !ok {
+				missing = append(missing, StripDate{t})
+			}
+		}
+	}
+	writeJSON(w, "missing API data", missing)
+}
+
+// CalendarDay is a day of the month returned by the calendar API. The URL is
+// empty if there is no strip for the day.
+type CalendarDay struct {
+	Date    StripDate `json:"date"`
+	Weekday string    `json:"weekday"`
+	Strip   bool      `json:"strip"`
+	URL     string    `json:"url,omitempty"`
+}
+
+// serveCalendarAPI lists every day of the month given by the "year" and
+// "month" query parameters, for rendering a month grid.
+func serveCalendarAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	query := r.URL.Query()
+
+	year, err := strconv.Atoi(query.Get("year"))
+	if err != nil || year < 1 || year > 9999 {
+		writeJSONError(w, "Malformed year", http.StatusBadRequest)
+		return
+	}
+	month, err := strconv.Atoi(query.Get("month"))
+	if err != nil || month < 1 || month > 12 {
+		writeJSONError(w, "Malformed month, expected 1 to 12", http.StatusBadRequest)
+		return
+	}
+
+	first := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	days := []CalendarDay{}
+	for t := first; t.Month() == first.Month(); t = t.AddDate(0, 0, 1) {
+		day := CalendarDay{Date: StripDate{t}, Weekday: t.Weekday().String()}
+		if strip, ok := idx.stripsByDate[t.Format("2006-01-02")]; ok {
+			day.Strip = true
+			day.URL = strip.URL
+		}
+		days = append(days, day)
+	}
+	writeJSON(w, "calendar API data", days)
+}
+
+// allFlushInterval is the number of strips after which the all-strips API
+// flushes the response, so clients receive it while it is written.
+const allFlushInterval = 1000
+
+// serveAllAPI lists every strip of the archive, or of the year given by the
+// "year" query parameter, as one JSON array. The array is written strip by
+// strip instead of being built in memory first.
+func serveAllAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	strips := idx.allStrips
+	if year := r.URL.Query().Get("year"); year != "" {
+		var ok bool
+		if strips, ok = idx.stripsByYear[year]; !ok {
+			writeJSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	w.Write([]byte("["))
+	for i, strip := range strips {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(strip); err != nil {
+			slog.Error("Error encoding API data", "data", "all strips", "error", err)
+			return
+		}
+		if (i+1)%allFlushInterval == 0 {
+			rc.Flush()
+		}
+	}
+	w.Write([]byte("]\n"))
+}
+
+func serveFirstAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	if idx.firstStrip == nil {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, "first API data", idx.firstStrip)
+}
+
+func serveLastAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	if idx.lastStrip == nil {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, "last API data", idx.lastStrip)
+}
+
+// serveDailyAPI returns the strip of the day. The pick is derived from a hash
+// of the current server-local date, so it is the same for every client and
+// changes at midnight.
+func serveDailyAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	if len(idx.allStrips) == 0 {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(time.Now().Format("2006-01-02")))
+	writeJSON(w, "daily API data", idx.allStrips[h.Sum64()%uint64(len(idx.allStrips))])
+}
+
+type Decade struct {
+	Decade string   `json:"decade"`
+	Years  []string `json:"years"`
+	Count  int      `json:"count"`
+}
+
+func serveDecadesAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	decades := []Decade{}
+	for _, year := range idx.yearsList {
+		y, err := strconv.Atoi(year)
+		if err != nil {
+			continue
+		}
+
+		label := strconv.Itoa(y/10*10) + "s"
+		if len(decades) == 0 || decades[len(decades)-1].Decade != label {
+			decades = append(decades, Decade{Decade: label})
+		}
+
+		d := &decades[len(decades)-1]
+		d.Years = append(d.Years, year)
+		d.Count += len(idx.stripsByYear[year])
+	}
+	writeJSON(w, "decades API data", decades)
+}
+
+// serveRandomAPI picks a strip uniformly at random, optionally limited to the
+// year given by the "year" query parameter. The math/rand/v2 top-level
+// generator is seeded randomly at startup, so picks differ across restarts.
+func serveRandomAPI(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	strips := idx.allStrips
+	if year := r.URL.Query().Get("year"); year != "" {
+		strips = idx.stripsByYear[year]
+	}
+
+	if len(strips) == 0 {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, "random API data", strips[rand.IntN(len(strips))])
+}
+
+// comicETag derives a strong ETag for a comic, which doesn't change while the
+// archive is loaded. Resized and re-encoded variants get a distinct tag each.
+func comicETag(f Entry, width, height int, format string) string {
+	etag := entryETag(f)
+	if width != 0 || height != 0 {
+		etag += fmt.Sprintf("-%dx%d", width, height)
+	}
+	if format != "" {
+		etag += "-" + format
+	}
+	return `"` + etag + `"`
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates the conditional request headers against the current
+// etag and modification time. If-Modified-Since is only considered when the
+// request carries no If-None-Match header.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+
+	if modTime.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// setComicCacheControl marks a comic image response as immutable, which holds
+// for as long as the archive stays loaded.
+func setComicCacheControl(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(comicMaxAge.Seconds())))
+}
+
+// contextReader stops reading from r once ctx is done, so that decompressing
+// a strip is abandoned as soon as the requesting client disconnects.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	w.Header().Set("Cache-Control", "no-store")
+	if idx == nil || !ready.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"loading"}` + "\n"))
+		return
+	}
+	writeJSON(w, "health data", map[string]any{"status": "ok", "strips": len(idx.allStrips)})
+}
+
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, "version data", buildInfo)
+}
+
+// requestedStrip returns the stripsByPath key for a request below prefix. It
+// is empty, and matches nothing, for paths that are absolute, contain ".."
+// segments or are otherwise not in their clean form.
+func requestedStrip(r *http.Request, prefix string) string {
+	reqStrip, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+	if err != nil {
+		return ""
+	}
+	reqStrip = strings.ReplaceAll(reqStrip, "\\", "/")
+	if strings.HasPrefix(reqStrip, "/") || path.Clean(reqStrip) != reqStrip ||
+		slices.Contains(strings.Split(reqStrip, "/"), "..") {
+		return ""
+	}
+	return reqStrip
+}
+
+func serveComics(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	reqStrip := requestedStrip(r, "/comics/")
+	file, found := idx.stripsByPath[reqStrip]
+	if found {
+		width, height, ok := parseResize(r)
+		if !ok {
+			http.Error(w, "Malformed image size", http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "webp" {
+			http.Error(w, "Unsupported image format", http.StatusBadRequest)
+			return
+		}
+
+		// Requests for the same output size share their ETag and cache
+		// entry. Images whose size can't be read fail to decode later on.
+		if width != 0 || height != 0 {
+			if w, h, err := outputSize(idx, reqStrip, file, width, height); err == nil {
+				width, height = w, h
+			}
+		}
+
+		if name := path.Base(reqStrip); len(name) >= 10 {
+			if t, err := time.Parse("2006-01-02", name[:10]); err == nil {
+				linkNextStrip(w, r, idx, t)
+			}
+		}
+
+		setComicCacheControl(w)
+		if len(signingKey) > 0 {
+			setSignedCacheControl(w, r)
+		}
+
+		etag := comicETag(file, width, height, format)
+		w.Header().Set("ETag", etag)
+		modTime := file.FileInfo().ModTime()
+		if !modTime.IsZero() {
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		}
+
+		if notModified(r, etag, modTime) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if format == "webp" {
+			data, err := webp(reqStrip, file, width, height)
+			if err == nil {
+				w.Header().Set("Content-Type", "image/webp")
+				http.ServeContent(w, r, reqStrip, modTime, bytes.NewReader(data))
+				return
+			}
+			slog.Warn("Unable to encode comic strip as WebP, serving original format", "path", reqStrip, "error", err)
+		}
+
+		if width != 0 || height != 0 {
+			data, err := resized(reqStrip, file, width, height)
+			if err != nil {
+				slog.Error("Unable to resize comic strip", "path", reqStrip, "error", err)
+				http.Error(w, "Unable to resize comic strip", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "image/jpeg")
+			http.ServeContent(w, r, reqStrip, modTime, bytes.NewReader(data))
+			return
+		}
+
+		var data []byte
+		if idx.preload != nil {
+			data, _ = idx.preload.get(reqStrip)
+		}
+		if data == nil {
+			f, err := file.Open()
+			if err != nil {
+				slog.Error("Unable to open comic strip", "path", reqStrip, "error", err)
+				http.Error(w, "Unable to open comic strip", http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+
+			// Archive members can't be seeked, so the strip is read into
+			// memory for http.ServeContent to answer range requests from.
+			data, err = io.ReadAll(contextReader{r.Context(), f})
+			if err != nil {
+				if r.Context().Err() != nil {
+					return
+				}
+				slog.Error("Unable to read comic strip", "path", reqStrip, "error", err)
+				http.Error(w, "Unable to read comic strip", http.StatusInternalServerError)
+				return
+			}
+
+			if idx.preload != nil {
+				idx.preload.put(reqStrip, data)
+			}
+		}
+
+		// Sniff the type from the content rather than the member name, which
+		// may not match the actual image format.
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		http.ServeContent(w, r, reqStrip, modTime, bytes.NewReader(data))
+	} else if r.URL.Query().Get("placeholder") == "1" {
+		width, height, ok := parseResize(r)
+		if !ok {
+			http.Error(w, "Malformed image size", http.StatusBadRequest)
+			return
+		}
+		servePlaceholder(w, width, height)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// setupLogging installs the default slog logger, which the log package
+// output is routed through as well.
+func setupLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	return nil
+}
+
+func main() {
+	var dilbertArc archivePaths
+	var showVersion bool
+	var host string
+	var port uint
+	var allowRandomPort bool
+	var shutdownTimeout time.Duration
+	var noCache bool
+	var watch bool
+	var watchInterval time.Duration
+	var reloadToken string
+	var extensionList string
+	var basePathFlag string
+	var trustedProxies string
+	var configPath string
+	var verify bool
+	var archiveSHA256 string
+	var cacheDir string
+	cacheDirSize := byteSize(1 << 30)
+	var preloadSize byteSize
+	var rateLimit float64
+	var rateBurst int
+	var authUser, authPass string
+	var pprofAddr string
+	var certFile, keyFile string
+	var logFormat, logLevel string
+	var accessLog bool
+	var corsOrigins string
+	var corsComics bool
+	var readHeaderTimeout, readTimeout, writeTimeout, idleTimeout time.Duration
+	var h2c bool
+	var signingKeyFlag string
+	var openApp bool
+	imageCacheSize := byteSize(256 << 20)
+
+	flag.StringVar(&configPath, "config", "", "TOML file with flag values, keyed by flag name; command-line flags take precedence")
+	flag.BoolVar(&verify, "verify", false, "Scan the archive, report strips and skipped files and exit, non-zero if any file was skipped")
+	flag.BoolVar(&showVersion, "version", false, "Print version information and exit")
+	flag.Var(&dilbertArc, "archive", "Path to dilbert 7z, ZIP or tar.gz archive, or to a directory of year folders, the single archive in the working directory if empty, downloaded first if it's an http(s) URL; may be repeated or comma-separated to merge several")
+	flag.StringVar(&host, "addr", "", "Host or IP address to bind to, all interfaces if empty")
+	flag.UintVar(&port, "port", 8080, "Port to listen on")
+	flag.BoolVar(&allowRandomPort, "allow-random-port", false, "Allow -port 0, which listens on a port picked by the system")
+	flag.BoolVar(&watch, "watch", false, "Reload the archive when it changes on disk, instead of only logging the change")
+	flag.StringVar(&reloadToken, "reload-token", "", "Bearer token for POST /admin/reload, the endpoint is disabled if empty")
+	flag.DurationVar(&watchInterval, "watch-interval", 10*time.Second, "How often the archive is checked for changes")
+	flag.StringVar(&trustedProxies, "trusted-proxy", "", "Comma-separated proxy addresses or CIDR ranges whose X-Forwarded-* headers are honored")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory to keep thumbnails and resized images in across restarts, disabled if empty")
+	flag.Var(&cacheDirSize, "cache-dir-size", "Maximum size of -cache-dir, like 500MB or 2GiB; least recently used images are removed beyond it")
+	flag.StringVar(&pprofAddr, "pprof", "", "Address, like localhost:6060, of a separate listener serving /debug/pprof, disabled if empty")
+	flag.StringVar(&authUser, "auth-user", "", "Require HTTP basic auth with this user name, together with -auth-pass")
+	flag.StringVar(&authPass, "auth-pass", "", "Password for -auth-user")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "Requests per second each client IP may make for comics, thumbnails and downloads, unlimited if 0")
+	flag.IntVar(&rateBurst, "rate-burst", 50, "Requests a client IP may make in a burst beyond -rate-limit")
+	flag.Var(&imageCacheSize, "image-cache-size", "Memory budget, like 256MB, each for resized and WebP images; least recently used ones are dropped beyond it, unlimited if 0")
+	flag.Var(&preloadSize, "preload", "Memory budget, like 512MB, for keeping decompressed strips in memory, disabled if 0")
+	flag.StringVar(&archiveSHA256, "archive-sha256", "", "Expected SHA-256 checksum, in hex, of an archive downloaded from an -archive URL")
+	flag.StringVar(&basePathFlag, "base-path", "", "Path prefix to serve everything below, like /dilbert for a reverse proxy")
+	flag.StringVar(&extensionList, "extensions", "jpg,gif", "Comma-separated file extensions to index, preferred in this order when files share a date")
+	flag.Int64Var(&maxDecodePixels, "max-decode-pixels", 50_000_000, "Largest image, in pixels, to read dimensions from, resize or re-encode, unlimited if 0")
+	flag.BoolVar(&quietSkips, "quiet", false, "Log skipped archive files only at debug level, keeping the summary per folder")
+	flag.IntVar(&scanWorkers, "scan-workers", runtime.NumCPU(), "Number of goroutines scanning the archive")
+	flag.BoolVar(&noCache, "no-cache", false, "Always rescan the archive instead of using the manifest cache next to it")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "Grace period for in-flight requests on shutdown")
+	flag.DurationVar(&comicMaxAge, "comic-max-age", 365*24*time.Hour, "How long clients may cache comic images")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 10*time.Second, "Maximum time to read request headers")
+	flag.DurationVar(&readTimeout, "read-timeout", 30*time.Second, "Maximum time to read an entire request")
+	flag.DurationVar(&writeTimeout, "write-timeout", 5*time.Minute, "Maximum time to write a response, must allow large comics to reach slow clients")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "Maximum time to keep idle keep-alive connections open")
+	flag.BoolVar(&openApp, "open", false, "Open the app in the default browser once the archive is loaded")
+	flag.StringVar(&signingKeyFlag, "signing-key", "", "Secret that comic, thumbnail, contact sheet and download URLs have to be signed with, see the sign command, unchecked if empty")
+	flag.BoolVar(&h2c, "h2c", false, "Also accept HTTP/2 without TLS, for proxies that speak h2c to the backend")
+	flag.BoolVar(&accessLog, "access-log", true, "Log every HTTP request")
+	flag.StringVar(&corsOrigins, "cors-origin", "", "Comma-separated origins allowed to use the API cross-origin, \"*\" for any, disabled if empty")
+	flag.BoolVar(&corsComics, "cors-comics", false, "Also send CORS headers for comic images")
+	flag.StringVar(&logFormat, "log-format", "text", "Log output format, text or json")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum log level, debug, info, warn or error")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file, serves HTTPS together with -key")
+	flag.StringVar(&keyFile, "key", "", "TLS private key file, serves HTTPS together with -cert")
+	documentEnv(flag.CommandLine)
+	flag.Parse()
+
+	if err := loadEnv(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid environment variable:", err)
+		os.Exit(2)
+	}
+
+	if configPath != "" {
+		if err := loadConfig(flag.CommandLine, configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to load config:", err)
+			os.Exit(2)
+		}
+	}
+
+	if showVersion {
+		fmt.Printf("dilbertd %s (commit %s, built %s)\n", version, commit, buildDate)
+		return
+	}
+
+	if err := setupLogging(logFormat, logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var err error
+	if extensions, err = parseExtensions(extensionList); err != nil {
+		slog.Error("Invalid -extensions", "error", err)
+		os.Exit(1)
+	}
+	basePath = normalizeBasePath(basePathFlag)
+	signingKey = []byte(signingKeyFlag)
+
+	// Signing URLs doesn't need the archive.
+	if flag.Arg(0) == "sign" {
+		os.Exit(runSign(os.Stdout, flag.Args()[1:]))
+	}
+
+	proxies, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		slog.Error("Invalid -trusted-proxy", "error", err)
+		os.Exit(1)
+	}
+
+	if (authUser == "") != (authPass == "") {
+		slog.Error("Both -auth-user and -auth-pass are required for basic auth")
+		os.Exit(1)
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		slog.Error("Both -cert and -key are required to serve HTTPS")
+		os.Exit(1)
+	}
+
+	if len(dilbertArc) == 0 {
+		path, err := findArchive(".")
+		if err != nil {
+			slog.Error("Unable to find archive", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Using archive from working directory", "path", path)
+		dilbertArc = archivePaths{path}
+	}
+
+	var downloads []string
+	removeDownloads := func() {
+		for _, path := range downloads {
+			os.Remove(path)
+		}
+	}
+	defer removeDownloads()
+
+	// exit doesn't run deferred calls, so it removes downloaded archives
+	// itself.
+	exit := func(status int) {
+		removeDownloads()
+		os.Exit(status)
+	}
+
+	urls := 0
+	for _, path := range dilbertArc {
+		if isArchiveURL(path) {
+			urls++
+		}
+	}
+	if archiveSHA256 != "" && urls != 1 {
+		slog.Error("-archive-sha256 requires exactly one archive URL")
+		os.Exit(1)
+	}
+
+	// A signal cancels a download, whose partial file is removed before
+	// exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fetchArchives := func() {
+		for i, path := range dilbertArc {
+			if !isArchiveURL(path) {
+				continue
+			}
+			local, err := fetchArchive(ctx, path, archiveSHA256)
+			if err != nil {
+				if ctx.Err() != nil {
+					slog.Info("Shutting down while downloading the archive", "url", path)
+				} else {
+					slog.Error("Unable to download archive", "url", path, "error", err)
+				}
+				exit(1)
+			}
+			downloads = append(downloads, local)
+			dilbertArc[i] = local
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "", "list":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", flag.Arg(0))
+		os.Exit(2)
+	}
+
+	if verify {
+		fetchArchives()
+		exit(verifyArchives(os.Stdout, dilbertArc))
+	}
+	if flag.Arg(0) == "list" {
+		fetchArchives()
+		exit(runList(flag.Args()[1:], dilbertArc))
+	}
+
+	if port > 65535 {
+		slog.Error("Invalid -port, must be between 1 and 65535", "port", port)
+		os.Exit(1)
+	}
+	if port == 0 && !allowRandomPort {
+		slog.Error("Refusing to listen on -port 0 without -allow-random-port")
+		os.Exit(1)
+	}
+
+	// Bind before downloading and scanning the archive, which can take a
+	// while, so a port conflict is reported right away.
+	addr := net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			slog.Error("Port is already in use, pick another one with -port", "port", port, "addr", addr)
+		} else {
+			slog.Error("Unable to listen", "addr", addr, "error", err)
+		}
+		os.Exit(1)
+	}
+
+	// Start profiling before the archive is scanned, so the scan can be
+	// profiled too.
+	if pprofAddr != "" {
+		go servePprof(pprofAddr)
+	}
+
+	resizeCache.maxBytes = int64(imageCacheSize)
+	webpCache.maxBytes = int64(imageCacheSize)
+
+	if cacheDir != "" {
+		if derivedCache, err = openDiskCache(cacheDir, int64(cacheDirSize)); err != nil {
+			slog.Error("Unable to open image cache directory", "path", cacheDir, "error", err)
+			exit(1)
+		}
+	}
+
+	// A downloaded archive gets a new name on every start, a manifest for it
+	// would never be used again. The paths are set once downloads are done.
+	rl := &reloader{
+		useCache:    !noCache && urls == 0,
+		preloadSize: int64(preloadSize),
+	}
+
+	api := http.NewServeMux()
+
+	api.Handle("/api/years", indexETagHandler(serveYearsAPI))
+	api.Handle("/api/years/detail", indexETagHandler(serveYearsDetailAPI))
+
+	api.Handle("/api/strips", indexETagHandler(serveStripsAPI))
+	api.Handle("/api/strips/", indexETagHandler(serveStripsAPI))
+
+	api.Handle("/api/strips/batch", indexETagHandler(serveBatchAPI))
+
+	api.Handle("/api/strip/", indexETagHandler(serveStripAPI))
+
+	api.Handle("/api/around/", indexETagHandler(serveAroundAPI))
+
+	api.HandleFunc("/api/onthisday", serveOnThisDayAPI)
+
+	api.Handle("/api/decades", indexETagHandler(serveDecadesAPI))
+
+	api.HandleFunc("/api/random", serveRandomAPI)
+
+	api.HandleFunc("/api/daily", serveDailyAPI)
+
+	api.Handle("/api/first", indexETagHandler(serveFirstAPI))
+
+	api.Handle("/api/last", indexETagHandler(serveLastAPI))
+
+	api.HandleFunc("/api/stats", serveStatsAPI)
+
+	api.Handle("/api/weekday-stats", indexETagHandler(serveWeekdayStatsAPI))
+
+	api.Handle("/api/skipped", indexETagHandler(serveSkippedAPI))
+
+	api.Handle("/api/missing", indexETagHandler(serveMissingAPI))
+
+	api.Handle("/api/calendar", indexETagHandler(serveCalendarAPI))
+
+	api.Handle("/api/search", indexETagHandler(serveSearchAPI))
+
+	api.Handle("/api/all", indexETagHandler(serveAllAPI))
+
+	api.HandleFunc("/api/", serveAPINotFound)
+
+	var apiHandler http.Handler = gzipHandler(api)
+	var comicsHandler http.Handler = http.HandlerFunc(serveComics)
+	var thumbsHandler http.Handler = http.HandlerFunc(serveThumbs)
+	var contactHandler http.Handler = http.HandlerFunc(serveContact)
+	var downloadHandler http.Handler = http.HandlerFunc(serveDownload)
+	if len(signingKey) > 0 {
+		comicsHandler = signedHandler(comicsHandler)
+		thumbsHandler = signedHandler(thumbsHandler)
+		contactHandler = signedHandler(contactHandler)
+		downloadHandler = signedHandler(downloadHandler)
+	}
+	if rateLimit > 0 {
+		limiter := newIPLimiter(rateLimit, max(1, rateBurst))
+		comicsHandler = rateLimitHandler(limiter, comicsHandler)
+		thumbsHandler = rateLimitHandler(limiter, thumbsHandler)
+		contactHandler = rateLimitHandler(limiter, contactHandler)
+		downloadHandler = rateLimitHandler(limiter, downloadHandler)
+	}
+	if corsOrigins != "" {
+		apiHandler = corsHandler(corsOrigins, apiHandler)
+		if corsComics {
+			comicsHandler = corsHandler(corsOrigins, comicsHandler)
+			thumbsHandler = corsHandler(corsOrigins, thumbsHandler)
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/api/", apiHandler)
+
+	mux.Handle("/comics/", comicsHandler)
+
+	mux.Handle("/thumbs/", thumbsHandler)
+
+	mux.Handle("/contact/", contactHandler)
+
+	mux.Handle("/download/", downloadHandler)
+
+	mux.HandleFunc("/feed.rss", serveRSS)
+	mux.HandleFunc("/feed.atom", serveAtom)
+
+	mux.HandleFunc("/healthz", serveHealth)
+
+	mux.HandleFunc("/version", serveVersion)
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.HandleFunc("/strip/", serveStripPage)
+
+	mux.HandleFunc("/", serveApp)
+
+	if reloadToken != "" {
+		mux.Handle("/admin/reload", reloadHandler(rl, reloadToken))
+	}
+
+	// The index is attached outside of the metrics, which read the route
+	// pattern the mux sets on the request it was given. The app shell doesn't
+	// need it, so the app and its service worker load during a cold start.
+	exempt := []string{"/healthz", "/version", "/metrics", "/", "/main.css"}
+	for path := range staticFiles {
+		exempt = append(exempt, path)
+	}
+	handler := indexHandler(exempt, instrumentHandler(mux))
+	if basePath != "" {
+		handler = basePathHandler(basePath, handler)
+	}
+	if authUser != "" {
+		// The reload endpoint checks its own bearer token, which takes the
+		// Authorization header basic auth would need.
+		exempt := []string{basePath + "/healthz", basePath + "/admin/reload"}
+		handler = basicAuthHandler(authUser, authPass, exempt, handler)
+	}
+	if accessLog {
+		handler = accessLogHandler(handler)
+	}
+	if len(proxies) > 0 {
+		handler = proxyHandler(proxies, handler)
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	if h2c {
+		// Setting the protocols replaces the defaults, so HTTP/2 over TLS
+		// has to be kept explicitly.
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if certFile != "" {
+			errc <- server.ServeTLS(ln, certFile, keyFile)
+		} else {
+			errc <- server.Serve(ln)
+		}
+	}()
+
+	// Requests are already answered while the archive is downloaded and
+	// scanned, with a 503 until its index is in place. The scan can't be
+	// interrupted, a signal exits without waiting for it.
+	slog.Info("Listening", "addr", ln.Addr().String())
+	fetchArchives()
+	rl.paths = dilbertArc
+
+	loaded := make(chan error, 1)
+	go func() {
+		_, _, err := rl.load()
+		loaded <- err
+	}()
+	select {
+	case err := <-loaded:
+		if errors.Is(err, errNoStrips) {
+			slog.Error("No comic strips were found in archive", "paths", dilbertArc)
+			exit(1)
+		}
+		if err != nil {
+			slog.Error("Unable to open archive", "paths", dilbertArc, "error", err)
+			exit(1)
+		}
+	case err := <-errc:
+		slog.Error("Failed to start webserver", "error", err)
+		exit(1)
+	case <-ctx.Done():
+		slog.Info("Shutting down while loading the archive")
+		exit(1)
+	}
+	defer rl.close()
+	ready.Store(true)
+
+	slog.Info("Serving comic strips", "strips", len(currentIndex.Load().stripsByPath), "addr", ln.Addr().String())
+
+	if openApp {
+		url := browserURL(ln.Addr(), certFile != "")
+		if err := openBrowser(url); err != nil {
+			slog.Warn("Unable to open browser", "url", url, "error", err)
+		}
+	}
+
+	go rl.watch(ctx, watchInterval, watch)
+
+	select {
+	case err := <-errc:
+		slog.Error("Failed to start webserver", "error", err)
+		exit(1)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Forcing shutdown", "error", err)
+		server.Close()
+	}
+}
+
+//go:embed frontend/src/index.html
+var indexHTML []byte
+
+//go:embed frontend/src/main.css
+var mainCSS []byte
+
+//go:embed frontend/src/favicon.ico
+var favicon []byte
+
+//go:embed frontend/src/icon-192.png
+var icon192 []byte
+
+//go:embed frontend/src/icon-512.png
+var icon512 []byte
+
+//go:embed frontend/src/manifest.webmanifest
+var webManifest []byte
+
+//go:embed frontend/src/sw.js
+var serviceWorker []byte
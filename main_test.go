@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStripDateJSON(t *testing.T) {
+	initial := StripDate{time.Date(2001, 5, 3, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		input   string
+		want    StripDate
+		wantErr bool
+	}{
+		{input: `"1989-04-16"`, want: StripDate{time.Date(1989, 4, 16, 0, 0, 0, 0, time.UTC)}},
+		{input: `"2000-02-29"`, want: StripDate{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC)}},
+		{input: `null`, want: initial},
+		{input: `"2001-13-01"`, wantErr: true},
+		{input: `"2001-02-30"`, wantErr: true},
+		{input: `20010101`, wantErr: true},
+		{input: `"x"`, wantErr: true},
+		{input: `""`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got := initial
+		err := json.Unmarshal([]byte(tt.input), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %v, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.want.Time) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+		if tt.input == "null" {
+			continue
+		}
+
+		// Marshaling the result has to give back the input.
+		data, err := json.Marshal(got)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", got, err)
+			continue
+		}
+		if string(data) != tt.input {
+			t.Errorf("Marshal(%v) = %s, want %s", got, data, tt.input)
+		}
+	}
+}
+
+func TestRequestedStrip(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/comics/2001/2001-01-01.gif", "2001/2001-01-01.gif"},
+		{"/comics/2001/file%20x.jpg", "2001/file x.jpg"},
+		{"/comics/2001%2F2001-01-01.gif", "2001/2001-01-01.gif"},
+		{"/comics/../../etc/passwd", ""},
+		{"/comics/2001/../../etc/passwd", ""},
+		{"/comics/%2e%2e%2f%2e%2e%2fetc/passwd", ""},
+		{"/comics/..%2F..%2Fetc%2Fpasswd", ""},
+		{"/comics/2001%2F..%2F..%2Fetc%2Fpasswd", ""},
+		{"/comics/..%5c..%5cetc%5cpasswd", ""},
+		{"/comics//etc/passwd", ""},
+		{"/comics/%2Fetc/passwd", ""},
+		{"/comics/2001//2001-01-01.gif", ""},
+		{"/comics/./2001/2001-01-01.gif", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if got := requestedStrip(r, "/comics/"); got != tt.want {
+			t.Errorf("requestedStrip(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestServeComicsPaths(t *testing.T) {
+	currentIndex.Store(scanComics(newFakeArchive(t, "2001/2001-01-01.gif", "2001/file x.jpg")))
+	t.Cleanup(func() { currentIndex.Store(nil) })
+	handler := indexHandler(nil, http.HandlerFunc(serveComics))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/comics/2001/2001-01-01.gif", http.StatusOK},
+		{"/comics/2001/file%20x.jpg", http.StatusOK},
+		{"/comics/../../etc/passwd", http.StatusNotFound},
+		{"/comics/%2e%2e%2f%2e%2e%2fetc/passwd", http.StatusNotFound},
+		{"/comics/..%2F..%2F2001%2F2001-01-01.gif", http.StatusNotFound},
+		{"/comics/..%5c..%5cetc%5cpasswd", http.StatusNotFound},
+		{"/comics//2001/2001-01-01.gif", http.StatusNotFound},
+		{"/comics/%2F2001/2001-01-01.gif", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestScanComicsSortsYears(t *testing.T) {
+	arc := newFakeArchive(t,
+		"2001/2001-03-05.gif",
+		"2000/2000-12-31.gif",
+		"2001/2001-01-02.gif",
+		"2000/2000-01-01.gif",
+		"2001/2001-12-31.gif",
+		"2001/2001-01-01.gif",
+		"2000/2000-06-15.gif",
+	)
+	idx := scanComics(arc)
+
+	if len(idx.allStrips) != len(arc.entries) {
+		t.Fatalf("indexed %d strips, want %d", len(idx.allStrips), len(arc.entries))
+	}
+	for _, year := range idx.yearsList {
+		strips := idx.stripsByYear[year]
+		for i := 1; i < len(strips); i++ {
+			if !strips[i-1].Date.Before(strips[i].Date.Time) {
+				t.Errorf("stripsByYear[%s] not ascending at %d: %s, %s", year, i,
+					strips[i-1].Date.Format("2006-01-02"), strips[i].Date.Format("2006-01-02"))
+			}
+		}
+	}
+	for i := 1; i < len(idx.allStrips); i++ {
+		if !idx.allStrips[i-1].Date.Before(idx.allStrips[i].Date.Time) {
+			t.Errorf("allStrips not ascending at %d", i)
+		}
+	}
+}
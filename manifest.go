@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// manifestVersion is bumped whenever the manifest layout changes, which
+// invalidates manifests written by older builds.
+const manifestVersion = 4
+
+// manifest is the on-disk cache of the index built by scanComics. It is only
+// valid for the archive with the same size and modification time, scanned for
+// the same file extensions, base path and pixel limit.
+type manifest struct {
+	Version        int               `json:"version"`
+	ArchiveSize    int64             `json:"archiveSize"`
+	ArchiveModTime time.Time         `json:"archiveModTime"`
+	Extensions     []string          `json:"extensions"`
+	BasePath       string            `json:"basePath"`
+	MaxPixels      int64             `json:"maxPixels"`
+	Paths          map[string]string `json:"paths"`
+	Strips         []ComicStrip      `json:"strips"`
+	Skipped        []SkippedFile     `json:"skipped"`
+}
+
+func manifestPath(archivePath string) string {
+	return archivePath + ".manifest.json"
+}
+
+// loadManifest restores the index from the manifest next to archivePath. It
+// fails if there is no manifest or it doesn't belong to the archive as it
+// currently is on disk.
+func loadManifest(archivePath string, arc Archive) (*stripIndex, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(manifestPath(archivePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("manifest version %d, expected %d", m.Version, manifestVersion)
+	}
+
+	if m.ArchiveSize != info.Size() || !m.ArchiveModTime.Equal(info.ModTime()) {
+		return nil, errors.New("manifest does not match archive")
+	}
+
+	if !slices.Equal(m.Extensions, extensions) {
+		return nil, errors.New("manifest was built for different file extensions")
+	}
+
+	if m.BasePath != basePath {
+		return nil, errors.New("manifest was built for a different base path")
+	}
+
+	if m.MaxPixels != maxDecodePixels {
+		return nil, errors.New("manifest was built for a different pixel limit")
+	}
+
+	entries := arc.Entries()
+	files := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		files[e.Name()] = e
+	}
+
+	byPath := make(map[string]Entry, len(m.Paths))
+	for key, name := range m.Paths {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("manifest references missing file %s", name)
+		}
+		byPath[key] = f
+	}
+
+	idx := &stripIndex{
+		arc:          arc,
+		stripsByPath: byPath,
+		stripsByYear: make(map[string][]ComicStrip),
+		skippedFiles: m.Skipped,
+	}
+	for _, strip := range m.Strips {
+		idx.stripsByYear[strip.Year] = append(idx.stripsByYear[strip.Year], strip)
+	}
+
+	idx.build()
+	return idx, nil
+}
+
+// saveManifest writes idx next to archivePath.
+func saveManifest(archivePath string, idx *stripIndex) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	m := manifest{
+		Version:        manifestVersion,
+		ArchiveSize:    info.Size(),
+		ArchiveModTime: info.ModTime(),
+		Extensions:     extensions,
+		BasePath:       basePath,
+		MaxPixels:      maxDecodePixels,
+		Paths:          make(map[string]string, len(idx.stripsByPath)),
+		Strips:         idx.allStrips,
+		Skipped:        idx.skippedFiles,
+	}
+	for key, f := range idx.stripsByPath {
+		m.Paths[key] = f.Name()
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated
+	// manifest behind.
+	tmp := manifestPath(archivePath) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, manifestPath(archivePath))
+}
+
+// loadIndex restores the index of arc from the manifest cache if possible and
+// falls back to scanning the archive, refreshing the manifest afterwards.
+func loadIndex(archivePath string, arc Archive, useCache bool) *stripIndex {
+	if useCache {
+		idx, err := loadManifest(archivePath, arc)
+		if err == nil {
+			slog.Info("Loaded index from manifest", "path", manifestPath(archivePath))
+			return idx
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Info("Ignoring manifest, rescanning archive", "path", manifestPath(archivePath), "reason", err)
+		}
+	}
+
+	idx := scanComics(arc)
+
+	if useCache {
+		if err := saveManifest(archivePath, idx); err != nil {
+			slog.Warn("Unable to write manifest", "path", manifestPath(archivePath), "error", err)
+		}
+	}
+	return idx
+}
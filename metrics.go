@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dilbertd_http_requests_total",
+		Help: "Number of HTTP requests by route and status code.",
+	}, []string{"route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dilbertd_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "dilbertd_strips_loaded",
+		Help: "Number of comic strips loaded from the archive.",
+	}, func() float64 {
+		idx := currentIndex.Load()
+		if idx == nil {
+			return 0
+		}
+		return float64(len(idx.stripsByPath))
+	})
+)
+
+// instrumentHandler records request metrics for next. Requests are labeled
+// with the pattern of the route that served them rather than the full path,
+// which keeps the label cardinality low.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(route, strconv.Itoa(rec.statusCode())).Inc()
+		httpDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// pageMeta holds the link preview tags rendered into the index page.
+type pageMeta struct {
+	title string
+	url   string
+	image string
+}
+
+func (m pageMeta) tags() []byte {
+	var b strings.Builder
+	tag := func(attr, name, content string) {
+		b.WriteString(`    <meta ` + attr + `="` + name + `" content="` + html.EscapeString(content) + `" />` + "\n")
+	}
+	tag("property", "og:type", "website")
+	tag("property", "og:site_name", "Dilbert")
+	tag("property", "og:title", m.title)
+	tag("property", "og:url", m.url)
+	if m.image != "" {
+		tag("property", "og:image", m.image)
+		tag("name", "twitter:card", "summary_large_image")
+		tag("name", "twitter:image", m.image)
+	} else {
+		tag("name", "twitter:card", "summary")
+	}
+	tag("name", "twitter:title", m.title)
+	return []byte(b.String())
+}
+
+// renderIndex returns the index page with a base element for basePath, which
+// the page's relative links resolve against, and the link preview tags of m
+// inserted into its head.
+func renderIndex(m pageMeta) []byte {
+	base := []byte(`    <base href="` + html.EscapeString(basePath) + `/" />` + "\n")
+	page := bytes.Replace(indexHTML, []byte("    <title>"), append(base, "    <title>"...), 1)
+
+	head := []byte("  </head>")
+	return bytes.Replace(page, head, append(m.tags(), head...), 1)
+}
+
+// serveStripPage serves the index page for a deep link to a single strip,
+// /strip/{date}, with preview tags pointing at that strip.
+func serveStripPage(w http.ResponseWriter, r *http.Request) {
+	idx := requestIndex(r)
+	date := strings.TrimPrefix(r.URL.Path, "/strip/")
+	strip, ok := idx.stripsByDate[date]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	base := baseURL(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(renderIndex(pageMeta{
+		title: stripTitle(strip),
+		url:   base + basePath + "/strip/" + date,
+		image: base + strip.URL,
+	}))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"container/list"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// preloadCache keeps decompressed strips in memory, up to maxBytes. Once
+// full, the least recently used strips are dropped for new ones.
+type preloadCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *lruItem, most recently used first
+	items    map[string]*list.Element
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type lruItem struct {
+	key  string
+	data []byte
+}
+
+func newPreloadCache(maxBytes int64) *preloadCache {
+	return &preloadCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *preloadCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.lru.MoveToFront(el)
+	return el.Value.(*lruItem).data, true
+}
+
+// put adds data, evicting the least recently used strips to make room.
+func (c *preloadCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+
+	for c.size+int64(len(data)) > c.maxBytes {
+		el := c.lru.Back()
+		item := el.Value.(*lruItem)
+		c.lru.Remove(el)
+		delete(c.items, item.key)
+		c.size -= int64(len(item.data))
+	}
+	c.items[key] = c.lru.PushFront(&lruItem{key, data})
+	c.size += int64(len(data))
+}
+
+// full reports whether data of size n would no longer fit without evicting.
+func (c *preloadCache) full(n int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size+n > c.maxBytes
+}
+
+// preloadEntry is a strip to be preloaded.
+type preloadEntry struct {
+	key string
+	f   Entry
+}
+
+// warm decompresses the strips of idx into its cache until it is full,
+// without evicting anything, or until idx is retired. The caller holds a
+// reference to idx, which warm releases.
+func (idx *stripIndex) warm() {
+	defer idx.release()
+
+	c := idx.preload
+	entries := preloadEntries(idx)
+	loaded := 0
+	for _, e := range entries {
+		if idx.retired.Load() || c.full(e.f.FileInfo().Size()) {
+			break
+		}
+
+		data, err := readEntry(e.f)
+		if err != nil {
+			slog.Warn("Unable to preload comic strip", "path", e.key, "error", err)
+			continue
+		}
+		c.put(e.key, data)
+		loaded++
+	}
+	slog.Info("Preloaded comic strips", "strips", loaded, "of", len(entries))
+}
+
+func readEntry(f Entry) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// PreloadStats describes the preload cache in the stats API.
+type PreloadStats struct {
+	Strips  int     `json:"strips"`
+	Bytes   int64   `json:"bytes"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+func (c *preloadCache) stats() *PreloadStats {
+	c.mu.Lock()
+	s := &PreloadStats{Strips: len(c.items), Bytes: c.size}
+	c.mu.Unlock()
+
+	s.Hits, s.Misses = c.hits.Load(), c.misses.Load()
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// preloadEntries lists the indexed strips, newest first, as those are the
+// most likely to be requested.
+func preloadEntries(idx *stripIndex) []preloadEntry {
+	entries := make([]preloadEntry, 0, len(idx.allStrips))
+	for i := len(idx.allStrips) - 1; i >= 0; i-- {
+		key := stripKey(idx.allStrips[i])
+		if f, ok := idx.stripsByPath[key]; ok {
+			entries = append(entries, preloadEntry{key, f})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientIP returns the address of the client, as set by proxyHandler if the
+// request came through a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limiterIdle is how long a client's limiter is kept after its last request.
+const limiterIdle = 5 * time.Minute
+
+// ipLimiter hands out a token bucket per client IP.
+type ipLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPLimiter(perSecond float64, burst int) *ipLimiter {
+	l := &ipLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+	go l.sweep()
+	return l
+}
+
+func (l *ipLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = time.Now()
+	l.mu.Unlock()
+	return c.limiter.Allow()
+}
+
+// sweep forgets clients that have been idle for limiterIdle, so the map
+// doesn't grow without bounds.
+func (l *ipLimiter) sweep() {
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for ip, c := range l.clients {
+			if time.Since(c.lastSeen) > limiterIdle {
+				delete(l.clients, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// rateLimitHandler answers with 429 Too Many Requests once a client exceeds
+// the rate of l.
+func rateLimitHandler(l *ipLimiter, next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(max(1, int(1/float64(l.limit))))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.allow(clientIP(r)) {
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloader opens the archives and swaps in their index on reload.
+type reloader struct {
+	mu          sync.Mutex
+	paths       []string
+	useCache    bool
+	preloadSize int64
+}
+
+// errNoStrips is returned by reloader.load for archives without any strips,
+// like one replaced by a wrong or empty file.
+var errNoStrips = errors.New("no comic strips were found in archive")
+
+// load opens the archives at the reloader's paths and installs their index.
+// The previous archives are closed once the requests still using them are
+// done. An index without strips isn't installed, the current one is kept.
+// It returns the number of strips before and after the reload.
+func (rl *reloader) load() (int, int, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	arc, err := openArchives(rl.paths)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// A directory's modification time doesn't reflect changes below it, so
+	// the manifest cache can't be validated and isn't used. Neither is it
+	// for merged archives, the manifest belongs to a single one.
+	_, isDir := arc.(*dirArchive)
+	_, isMulti := arc.(*multiArchive)
+
+	idx := loadIndex(rl.paths[0], arc, rl.useCache && !isDir && !isMulti)
+	if len(idx.yearsList) == 0 {
+		idx.close()
+		return 0, 0, errNoStrips
+	}
+	idx.version = indexVersions.Add(1)
+	if rl.preloadSize > 0 {
+		idx.preload = newPreloadCache(rl.preloadSize)
+		idx.refs.Add(1)
+		go idx.warm()
+	}
+
+	old := currentIndex.Swap(idx)
+	thumbCache.reset()
+	resizeCache.reset()
+	webpCache.reset()
+	contactCache.reset()
+
+	before := 0
+	if old != nil {
+		before = len(old.allStrips)
+		old.retire()
+	}
+	return before, len(idx.allStrips), nil
+}
+
+func (rl *reloader) reload() (int, int, error) {
+	before, after, err := rl.load()
+	if err != nil {
+		slog.Error("Unable to reload archive", "paths", rl.paths, "error", err)
+		return 0, 0, err
+	}
+	slog.Info("Reloaded archive", "paths", rl.paths, "before", before, "strips", after)
+	return before, after, nil
+}
+
+func (rl *reloader) close() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if idx := currentIndex.Load(); idx != nil {
+		idx.retire()
+	}
+}
+
+// watch polls the archive paths every interval and, if reload is set,
+// reloads once a change has settled, so an archive that is still being
+// written isn't picked up. Otherwise the change is only logged, as the
+// running server keeps serving the archive it opened. An archive replaced by
+// renaming a new file over it is detected even if size and modification time
+// were kept.
+func (rl *reloader) watch(ctx context.Context, interval time.Duration, reload bool) {
+	last := make([]os.FileInfo, len(rl.paths))
+	for i, path := range rl.paths {
+		last[i], _ = os.Stat(path)
+	}
+	changed := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		settled := true
+		for i, path := range rl.paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				slog.Warn("Unable to stat archive", "path", path, "error", err)
+				settled = false
+				continue
+			}
+
+			if last[i] == nil || !os.SameFile(info, last[i]) ||
+				info.Size() != last[i].Size() || !info.ModTime().Equal(last[i].ModTime()) {
+				slog.Info("Archive changed, waiting for it to settle", "path", path)
+				last[i] = info
+				changed = true
+				settled = false
+			}
+		}
+
+		if changed && settled {
+			changed = false
+			if reload {
+				rl.reload()
+			} else {
+				slog.Warn("Archive changed on disk, still serving the previously opened one until reloaded", "paths", rl.paths)
+			}
+		}
+	}
+}
+
+// ReloadResult is returned by the /admin/reload endpoint.
+type ReloadResult struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// reloadHandler re-indexes the archive on POST requests that carry token as a
+// bearer token.
+func reloadHandler(rl *reloader, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dilbertd"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		before, after, err := rl.reload()
+		if err != nil {
+			http.Error(w, "Unable to reload archive", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, "reload result", ReloadResult{Before: before, After: after})
+	})
+}
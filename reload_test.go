@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestReloadConcurrentReads swaps indexes, both through reloader.load and
+// directly, while requests are served from them. Run it with -race.
+func TestReloadConcurrentReads(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "2001"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range newFakeArchive(t, "2001/2001-01-01.gif", "2001/2001-01-02.gif").entries {
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), e.(fakeEntry).data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rl := &reloader{paths: []string{dir}}
+	if _, _, err := rl.load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rl.close()
+		currentIndex.Store(nil)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/strips/", indexETagHandler(serveStripsAPI))
+	mux.Handle("/api/strip/", indexETagHandler(serveStripAPI))
+	mux.HandleFunc("/api/stats", serveStatsAPI)
+	mux.HandleFunc("/comics/", serveComics)
+	mux.HandleFunc("/thumbs/", serveThumbs)
+	handler := indexHandler(nil, mux)
+
+	paths := []string{
+		"/api/strips/2001",
+		"/api/strip/2001-01-01",
+		"/api/stats",
+		"/comics/2001/2001-01-01.gif",
+		"/comics/2001/2001-01-02.gif?w=30",
+		"/thumbs/2001/2001-01-02.gif",
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			for n := 0; ; n++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				p := paths[(i+n)%len(paths)]
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("GET %s: status %d: %s", p, rec.Code, rec.Body)
+				}
+			}
+		})
+	}
+
+	for i := range 50 {
+		if i%2 == 0 {
+			if _, _, err := rl.load(); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+
+		idx := scanComics(newFakeArchive(t, "2001/2001-01-02.gif", "2001/2001-01-01.gif"))
+		idx.version = indexVersions.Add(1)
+		if old := currentIndex.Swap(idx); old != nil {
+			old.retire()
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestRetiredIndexClosedAfterRelease checks that a retired index keeps its
+// archive open until the last request using it releases it.
+func TestRetiredIndexClosedAfterRelease(t *testing.T) {
+	arc := newFakeArchive(t, "2001/2001-01-01.gif")
+	currentIndex.Store(scanComics(arc))
+	t.Cleanup(func() { currentIndex.Store(nil) })
+
+	idx := acquireIndex()
+	if old := currentIndex.Swap(scanComics(newFakeArchive(t))); old != nil {
+		old.retire()
+	}
+	if arc.closed.Load() {
+		t.Fatal("archive closed while in use")
+	}
+
+	idx.release()
+	if !arc.closed.Load() {
+		t.Fatalf("archive still open with %d references", idx.refs.Load())
+	}
+}
+
+// TestReloadKeepsIndexWithoutStrips checks that a reload of an archive that
+// lost all its strips keeps serving the previous index.
+func TestReloadKeepsIndexWithoutStrips(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "2001"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	strip := filepath.Join(dir, "2001", "2001-01-01.gif")
+	if err := os.WriteFile(strip, newFakeArchive(t, "2001/2001-01-01.gif").entries[0].(fakeEntry).data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rl := &reloader{paths: []string{dir}}
+	if _, _, err := rl.load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rl.close()
+		currentIndex.Store(nil)
+	})
+	idx := currentIndex.Load()
+
+	if err := os.Remove(strip); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rl.load(); !errors.Is(err, errNoStrips) {
+		t.Fatalf("load() = %v, want %v", err, errNoStrips)
+	}
+	if currentIndex.Load() != idx {
+		t.Fatal("index without strips was installed")
+	}
+}